@@ -0,0 +1,243 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	gocontext "context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// The benchAlpha is the significance level of the comparison with the baseline: changes with a
+// higher p-value are reported as insignificant.
+const benchAlpha = 0.05
+
+// The benchUnits are the units of 'go test -bench -benchmem' in the order 'go test' prints them.
+var benchUnits = map[string]int{"ns/op": 0, "MB/s": 1, "B/op": 2, "allocs/op": 3}
+
+// Bench runs the benchmarks of the burrow project, stores the results for the current version and
+// commit and compares them against a baseline.
+func Bench(context *cli.Context, useSecondLevelArgs bool) error {
+	burrow.LoadConfig()
+	if err := runPrerequisites(context, "bench"); err != nil {
+		return err
+	}
+	return bench(context, useSecondLevelArgs)
+}
+
+// bench runs the benchmarks without running its prerequisites. The action fails when a benchmark is
+// significantly slower than the baseline by more than the bench.maxregression of the burrow.yaml.
+func bench(context *cli.Context, useSecondLevelArgs bool) error {
+	config := burrow.Config.Bench
+	pattern := context.String("bench")
+	if pattern == "" {
+		pattern = "."
+	}
+	count := context.Int("count")
+	if count < 1 {
+		count = config.Count
+	}
+	if count < 1 {
+		count = 10
+	}
+	benchtime := context.String("benchtime")
+	if benchtime == "" {
+		benchtime = config.Benchtime
+	}
+	ref := context.String("baseline")
+	if ref == "" {
+		ref = config.Baseline
+	}
+
+	baseline, hasBaseline, err := burrow.FindBenchRun(ref)
+	if err != nil {
+		burrow.Log(burrow.LOG_WARN, "bench", "Ignoring unreadable benchmark results: %s", err)
+		hasBaseline = false
+	}
+	if ref != "" && !hasBaseline {
+		burrow.Log(burrow.LOG_ERR, "bench", "There are no benchmark results of '%s'", ref)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	args := []string{"test", "-run", "^$", "-bench", pattern, "-benchmem", "-count", strconv.Itoa(count)}
+	if benchtime != "" {
+		args = append(args, "-benchtime", benchtime)
+	}
+	userArgs := []string{}
+	if useSecondLevelArgs {
+		userArgs = burrow.GetSecondLevelArgs()
+	}
+	flags, patterns := burrow.SplitTestArgs(userArgs)
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	args = append(append(args, flags...), patterns...)
+
+	run := burrow.NewBenchRun()
+	burrow.Log(burrow.LOG_INFO, "bench", "Running benchmarks %d times each", count)
+	recorder := burrow.NewBenchRecorder("bench", &run)
+	if err := burrow.ExecWriter(gocontext.Background(), "bench", "", nil, recorder, "go", args...); err != nil {
+		return err
+	}
+	burrow.Deprecation("bench", append([]string{"go"}, args...))
+
+	if len(run.Benchmarks) == 0 {
+		burrow.Log(burrow.LOG_WARN, "bench", "There are no benchmarks matching '%s'", pattern)
+		return nil
+	}
+	if err := run.Write(); err != nil {
+		burrow.Log(burrow.LOG_ERR, "bench", "Failed to store the benchmark results: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	burrow.Log(burrow.LOG_INFO, "bench", "Stored the benchmark results as %s", run.Name)
+
+	if !hasBaseline {
+		rows := [][]string{{"PACKAGE", "BENCHMARK", "UNIT", run.Name}}
+		for _, benchmark := range run.Benchmarks {
+			for _, unit := range sortedUnits(benchmark.Samples) {
+				summary := burrow.SummarizeSamples(benchmark.Samples[unit])
+				rows = append(rows, []string{benchmark.Package, benchmark.Name, unit, formatBenchSummary(summary)})
+			}
+		}
+		logTable("bench", rows)
+		burrow.Log(burrow.LOG_INFO, "bench", "There are no earlier results to compare against")
+		return nil
+	}
+
+	regressions := []string{}
+	rows := [][]string{{"PACKAGE", "BENCHMARK", "UNIT", baseline.Name, run.Name, "DELTA"}}
+	for _, benchmark := range run.Benchmarks {
+		old, _ := baseline.Find(benchmark.Package, benchmark.Name)
+		for _, unit := range sortedUnits(benchmark.Samples) {
+			current := burrow.SummarizeSamples(benchmark.Samples[unit])
+			if len(old.Samples[unit]) == 0 {
+				rows = append(rows, []string{benchmark.Package, benchmark.Name, unit, "-", formatBenchSummary(current), "new"})
+				continue
+			}
+			previous := burrow.SummarizeSamples(old.Samples[unit])
+			p := burrow.MannWhitneyU(previous.Values, current.Values)
+			samples := fmt.Sprintf("(p=%.3f n=%d+%d)", p, len(previous.Values), len(current.Values))
+
+			delta := "~ " + samples
+			if p < benchAlpha && previous.Mean != 0 {
+				change := (current.Mean - previous.Mean) * 100 / math.Abs(previous.Mean)
+				delta = fmt.Sprintf("%+.2f%% %s", change, samples)
+
+				regression := change
+				if burrow.HigherIsBetter(unit) {
+					regression = -change
+				}
+				if config.MaxRegression > 0 && regression > config.MaxRegression {
+					regressions = append(regressions, fmt.Sprintf(
+						"%s %s regressed by %.1f%% in %s, which exceeds the limit of %.1f%%",
+						benchmark.Package, benchmark.Name, regression, unit, config.MaxRegression,
+					))
+				}
+			}
+			rows = append(rows, []string{
+				benchmark.Package, benchmark.Name, unit, formatBenchSummary(previous), formatBenchSummary(current), delta,
+			})
+		}
+	}
+	logTable("bench", rows)
+
+	for _, regression := range regressions {
+		burrow.Log(burrow.LOG_ERR, "bench", "%s", regression)
+	}
+	if len(regressions) > 0 {
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	return nil
+}
+
+// BenchList lists the stored benchmark results, the most recent results first.
+func BenchList(context *cli.Context) error {
+	burrow.LoadConfig()
+
+	runs, err := burrow.ReadBenchRuns()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "bench", "Failed to read the benchmark results: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	if len(runs) == 0 {
+		burrow.Log(burrow.LOG_INFO, "bench", "No benchmark results have been stored")
+		return nil
+	}
+
+	rows := [][]string{{"NAME", "VERSION", "DATE", "GO", "BENCHMARKS"}}
+	for _, run := range runs {
+		rows = append(rows, []string{
+			run.Name, run.Version, run.Date.Local().Format("2006-01-02 15:04"), run.GoVersion, strconv.Itoa(len(run.Benchmarks)),
+		})
+	}
+	logTable("bench", rows)
+	return nil
+}
+
+// sortedUnits returns the units of the samples of a benchmark, the units of 'go test' first.
+func sortedUnits(samples map[string][]float64) []string {
+	units := make([]string, 0, len(samples))
+	for unit := range samples {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		rank := func(unit string) int {
+			if rank, ok := benchUnits[unit]; ok {
+				return rank
+			}
+			return len(benchUnits)
+		}
+		if rank(units[i]) != rank(units[j]) {
+			return rank(units[i]) < rank(units[j])
+		}
+		return units[i] < units[j]
+	})
+	return units
+}
+
+// formatBenchSummary formats the mean and the relative deviation of the samples of a benchmark, e.g.
+// "1.23k ± 2%".
+func formatBenchSummary(summary burrow.BenchSummary) string {
+	return fmt.Sprintf("%s ± %.0f%%", formatBenchValue(summary.Mean), summary.Diff*100)
+}
+
+// formatBenchValue formats a value with three significant digits and an SI prefix, e.g. 1.23M.
+func formatBenchValue(value float64) string {
+	prefix := ""
+	for _, next := range []string{"k", "M", "G", "T"} {
+		if math.Abs(value) < 999.5 {
+			break
+		}
+		value /= 1000
+		prefix = next
+	}
+	switch {
+	case math.Abs(value) < 9.995:
+		return fmt.Sprintf("%.2f%s", value, prefix)
+	case math.Abs(value) < 99.95:
+		return fmt.Sprintf("%.1f%s", value, prefix)
+	}
+	return fmt.Sprintf("%.0f%s", value, prefix)
+}
@@ -21,8 +21,10 @@
 package burrow
 
 import (
-	"os"
-	"path/filepath"
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/EmbeddedEnterprises/burrow/utils"
@@ -33,65 +35,427 @@ import (
 // Build builds a burrow application to bin/.
 func Build(context *cli.Context, useSecondLevelArgs bool) error {
 	burrow.LoadConfig()
+	if err := runPrerequisites(context, "build"); err != nil {
+		return err
+	}
+	return build(context, useSecondLevelArgs)
+}
 
-	outputs := []string{}
-	sources := []string{}
+// The platform struct describes a target platform of a cross-compilation. The variant is the
+// optional third part of a platform like linux/arm/v7 and selects GOARM, GOAMD64 and the like.
+type platform struct {
+	GOOS    string
+	GOARCH  string
+	Variant string
+}
+
+// variantVars maps an architecture to the go environment variable that is set by a variant.
+var variantVars = map[string]string{
+	"386":      "GO386",
+	"amd64":    "GOAMD64",
+	"arm":      "GOARM",
+	"arm64":    "GOARM64",
+	"mips":     "GOMIPS",
+	"mipsle":   "GOMIPS",
+	"mips64":   "GOMIPS64",
+	"mips64le": "GOMIPS64",
+	"ppc64":    "GOPPC64",
+	"ppc64le":  "GOPPC64",
+	"riscv64":  "GORISCV64",
+}
+
+// parsePlatform parses a platform in the form goos/goarch[/variant].
+func parsePlatform(value string) (platform, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return platform{}, fmt.Errorf("expected goos/goarch[/variant]")
+	}
+	p := platform{GOOS: parts[0], GOARCH: parts[1]}
+	if len(parts) == 3 {
+		if _, ok := variantVars[p.GOARCH]; !ok {
+			return platform{}, fmt.Errorf("architecture %s has no variants", p.GOARCH)
+		}
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
 
-	_, err := os.Stat("main.go")
-	if err == nil {
-		outputs = append(outputs, "./bin/"+burrow.Config.Name)
-		sources = append(sources, "main.go")
+// String returns the platform in the form goos/goarch[/variant].
+func (p platform) String() string {
+	if p.Variant == "" {
+		return p.GOOS + "/" + p.GOARCH
 	}
+	return p.GOOS + "/" + p.GOARCH + "/" + p.Variant
+}
+
+// Dir returns the name of the directory in bin/ the binaries of the platform are built to.
+func (p platform) Dir() string {
+	return strings.Replace(p.String(), "/", "_", -1)
+}
 
-	_ = filepath.Walk("./example", func(path string, f os.FileInfo, err error) error {
-		if strings.HasSuffix(path, ".go") && !f.IsDir() {
-			name := f.Name()
-			outputs = append(outputs, "./bin/example/"+name[:len(name)-3])
-			sources = append(sources, path)
+// Env returns the environment variables that select the platform for the go tool.
+func (p platform) Env() []string {
+	env := []string{"GOOS=" + p.GOOS, "GOARCH=" + p.GOARCH}
+	if p.Variant != "" {
+		variant := p.Variant
+		if p.GOARCH == "arm" {
+			variant = strings.TrimPrefix(variant, "v")
 		}
-		return nil
-	})
+		env = append(env, variantVars[p.GOARCH]+"="+variant)
+	}
+	return env
+}
+
+// getPlatforms returns the platforms given with --platform or, if there are none, the platforms of
+// the burrow.yaml.
+func getPlatforms(context *cli.Context) ([]platform, error) {
+	values := []string{}
+	for _, value := range context.StringSlice("platform") {
+		values = append(values, strings.Split(value, ",")...)
+	}
+	if len(values) == 0 {
+		values = burrow.Config.Build.Platforms
+	}
+
+	platforms := []platform{}
+	for _, value := range values {
+		p, err := parsePlatform(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid platform '%s': %s", value, err)
+		}
+		platforms = append(platforms, p)
+	}
+	return platforms, nil
+}
+
+// build builds the application without running its prerequisites. Without platforms the binaries
+// are built for the host to bin/, otherwise they are built for every platform to bin/<goos>_<goarch>/.
+func build(context *cli.Context, useSecondLevelArgs bool) error {
+	platforms, err := getPlatforms(context)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "build", "Failed to read platforms: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	profile, err := burrow.GetProfile(context.String("profile"))
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "build", "Failed to read profile: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
 
-	if burrow.IsTargetUpToDate("build", outputs) && !context.Bool("force") {
-		burrow.Log(burrow.LOG_INFO, "build", "Build is up-to-date")
+	binaries, err := burrow.GetBinaries()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "build", "Failed to find the binaries of the project: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	if len(binaries) == 0 {
+		burrow.Log(burrow.LOG_INFO, "build", "There are no main packages to build")
 		return nil
 	}
 
-	burrow.Log(burrow.LOG_INFO, "build", "Building project")
+	if err := burrow.GenerateBuildInfoPackage(); err != nil {
+		burrow.Log(burrow.LOG_ERR, "build", "Failed to generate the buildinfo package: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	artifacts := []burrow.Artifact{}
+	if len(platforms) == 0 {
+		if artifacts, err = buildPlatform(context, profile, nil, binaries, useSecondLevelArgs); err != nil {
+			return err
+		}
+	}
+	for i := range platforms {
+		built, err := buildPlatform(context, profile, &platforms[i], binaries, useSecondLevelArgs)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, built...)
+	}
 
-	_ = os.Mkdir("./bin", 0755)
+	manifest := profile.OutputDir() + "/manifest.json"
+	if err := burrow.WriteManifest(manifest, artifacts); err != nil {
+		burrow.Log(burrow.LOG_WARN, "build", "Failed to write %s: %s", manifest, err)
+	}
+	return nil
+}
+
+// getBuildOutputs returns the paths of all binaries the build action creates for the profile and
+// platforms given with --profile and --platform or in the burrow.yaml.
+func getBuildOutputs(context *cli.Context) ([]string, error) {
+	platforms, err := getPlatforms(context)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := burrow.GetProfile(context.String("profile"))
+	if err != nil {
+		return nil, err
+	}
+	binaries, err := burrow.GetBinaries()
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []string{}
+	if len(platforms) == 0 {
+		for _, binary := range binaries {
+			outputs = append(outputs, outputPath(profile, nil, binary))
+		}
+	}
+	for i := range platforms {
+		for _, binary := range binaries {
+			outputs = append(outputs, outputPath(profile, &platforms[i], binary))
+		}
+	}
+	return outputs, nil
+}
+
+// outputPath returns the path a binary is built to with a profile for a platform. A nil platform is
+// the host.
+func outputPath(profile burrow.Profile, p *platform, binary burrow.Binary) string {
+	dir := profile.OutputDir()
+	if p == nil {
+		return dir + "/" + binary.Name
+	}
+	if p.GOOS == "windows" {
+		return dir + "/" + p.Dir() + "/" + binary.Name + ".exe"
+	}
+	return dir + "/" + p.Dir() + "/" + binary.Name
+}
+
+// buildPlatform builds the binaries with a profile for a single platform and returns their manifest
+// entries. A nil platform builds for the host.
+func buildPlatform(context *cli.Context, profile burrow.Profile, p *platform, binaries []burrow.Binary, useSecondLevelArgs bool) ([]burrow.Artifact, error) {
+	name := "build"
+	description := ""
+	env := []string{}
+	if profile.Name != "" {
+		name += "-" + profile.Name
+		description = " with profile " + profile.Name
+	}
+	if p != nil {
+		name += "-" + p.Dir()
+		description += " for " + p.String()
+		env = append(env, p.Env()...)
+	}
+	if context.Bool("reproducible") {
+		env = append(env, reproducibleEnv...)
+		env = append(env, "SOURCE_DATE_EPOCH="+burrow.GetSourceDateEpoch())
+	}
+	env = append(env, profile.Environ()...)
 
 	userArgs, err := shellwords.Parse(burrow.Config.Args.Go.Build)
 	if err != nil {
 		burrow.Log(burrow.LOG_ERR, "build", "Failed to read user arguments from config file: %s", err)
-		return err
+		return nil, err
+	}
+	profileArgs, err := profile.Args()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "build", "Failed to read the flags of profile %s: %s", profile.Name, err)
+		return nil, cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	flags := append(append([]string{}, userArgs...), profileArgs...)
+	flags = addLdFlags(flags, profile.Ldflags)
+	if useSecondLevelArgs {
+		flags = append(flags, burrow.GetSecondLevelArgs()...)
+	}
+	flags, err = addBuildInfo(flags, env)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "build", "Failed to read the build information: %s", err)
+		return nil, cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	if context.Bool("reproducible") {
+		flags = reproducibleFlags(flags)
 	}
-	buildArgs := burrow.GetSecondLevelArgs()
 
-	deprecationArgs := make([][]string, 0)
-	for i, output := range outputs {
+	keyArgs := append([]string{}, flags...)
+	outputs := []string{}
+	commands := [][]string{}
+	packages := map[string][]string{}
+	pgoFiles := []string{}
+	for _, binary := range binaries {
+		binaryArgs, err := binary.BuildArgs(profile.Tags...)
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "build", "Failed to read the flags of binary %s: %s", binary.Name, err)
+			return nil, cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+
+		binaryArgs = append(binaryArgs, binary.PgoArgs(profile.Pgo)...)
+
+		output := outputPath(profile, p, binary)
 		args := []string{}
 		args = append(args, "build", "-o", output)
-		args = append(args, userArgs...)
+		args = append(args, flags...)
+		args = append(args, binaryArgs...)
+		args = append(args, binary.Package)
 
-		if useSecondLevelArgs {
-			args = append(args, buildArgs...)
+		outputs = append(outputs, output)
+		commands = append(commands, args)
+		keyArgs = append(keyArgs, "binary="+binary.Name+" "+strings.Join(append(binaryArgs, binary.Package), " "))
+
+		tags := strings.Join(binary.AllTags(profile.Tags...), ",")
+		packages[tags] = append(packages[tags], binary.PackageDir())
+		if pgoFile, ok := binary.PgoFile(); ok && profile.Pgo {
+			pgoFiles = append(pgoFiles, path.Clean(pgoFile))
 		}
+	}
 
-		args = append(args, sources[i])
+	files := map[string]bool{}
+	for _, file := range pgoFiles {
+		files[file] = true
+	}
+	for tags, dirs := range packages {
+		patterns := dirs
+		if tags != "" {
+			patterns = append([]string{"-tags", tags}, dirs...)
+		}
+		for _, file := range burrow.GetPackageInputs("build", env, false, patterns...) {
+			files[file] = true
+		}
+	}
+	inputs := []string{}
+	for file := range files {
+		inputs = append(inputs, file)
+	}
+	sort.Strings(inputs)
 
-		deprecationArgs = append(deprecationArgs, append([]string{"go"}, args...))
+	target := burrow.Target{
+		Name:    name,
+		Args:    keyArgs,
+		Env:     env,
+		Inputs:  inputs,
+		Outputs: outputs,
+	}
 
-		if err = burrow.Exec("build", "go", args...); err != nil {
-			return err
-		}
+	if !context.Bool("force") && burrow.IsTargetUpToDate(target) {
+		burrow.Log(burrow.LOG_INFO, "build", "Build%s is up-to-date", description)
+		return describeBinaries(profile, p, env, outputs, commands), nil
 	}
 
-	if err == nil {
-		burrow.UpdateTarget("build", outputs)
+	burrow.Log(burrow.LOG_INFO, "build", "Building project%s", description)
+
+	jobs := []burrow.Job{}
+	deprecationArgs := make([][]string, 0)
+	for i, args := range commands {
+		deprecationArgs = append(deprecationArgs, goCommand(env, args))
+
+		jobs = append(jobs, burrow.Job{
+			Target: path.Base(binaries[i].Name),
+			Dir:    ".",
+			Env:    env,
+			Comm:   "go",
+			Args:   args,
+		})
 	}
 
+	n := context.Int("jobs")
+	if n < 1 {
+		n = runtime.NumCPU()
+	}
+	if err = burrow.RunJobs(n, jobs); err != nil {
+		return nil, err
+	}
+
+	burrow.UpdateTarget(target)
 	burrow.Deprecation("build", deprecationArgs...)
 
-	return err
+	return describeBinaries(profile, p, env, outputs, commands), nil
+}
+
+// describeBinaries returns the manifest entries of the binaries built with a profile for a platform.
+func describeBinaries(profile burrow.Profile, p *platform, env []string, outputs []string, commands [][]string) []burrow.Artifact {
+	platform := burrow.GetGoEnv()["GOOS"] + "/" + burrow.GetGoEnv()["GOARCH"]
+	if p != nil {
+		platform = p.String()
+	}
+
+	artifacts := []burrow.Artifact{}
+	for i, output := range outputs {
+		artifact, err := burrow.NewArtifact(output, goCommand(env, commands[i]))
+		if err != nil {
+			burrow.Log(burrow.LOG_WARN, "build", "Failed to describe %s: %s", output, err)
+			continue
+		}
+		artifact.Platform = platform
+		artifact.Profile = profile.Name
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts
+}
+
+// The reproducibleEnv clears the environment variables that are known to leak paths or settings of
+// the build host into binaries.
+var reproducibleEnv = []string{
+	"GOFLAGS=", "CGO_CFLAGS=", "CGO_CPPFLAGS=", "CGO_CXXFLAGS=", "CGO_FFLAGS=", "CGO_LDFLAGS=", "GOROOT_FINAL=",
+}
+
+// reproducibleFlags enforces the go build flags of a reproducible build: -trimpath removes the paths
+// of the build host and -buildvcs=false leaves out the state of the working tree, which is injected
+// as build metadata instead.
+func reproducibleFlags(args []string) []string {
+	flags := []string{}
+	trimpath := false
+	for _, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if strings.HasPrefix(name, "buildvcs") {
+			continue
+		}
+		if name == "trimpath" || name == "trimpath=true" {
+			trimpath = true
+		}
+		flags = append(flags, arg)
+	}
+	if !trimpath {
+		flags = append(flags, "-trimpath")
+	}
+	return append(flags, "-buildvcs=false")
+}
+
+// addLdFlags adds linker flags to the last -ldflags argument of the go build arguments, as go build
+// only respects the last one. A trailing -ldflags argument without value gets the flags as value. If
+// there is no -ldflags argument a new one is appended.
+func addLdFlags(args []string, flags string) []string {
+	if flags == "" {
+		return args
+	}
+	args = append([]string{}, args...)
+	for i := len(args) - 1; i >= 0; i-- {
+		arg := strings.TrimPrefix(args[i], "-")
+		if arg == "-ldflags" || arg == "ldflags" {
+			if i+1 == len(args) {
+				return append(args, flags)
+			}
+			args[i+1] = strings.TrimSpace(args[i+1] + " " + flags)
+			return args
+		}
+		if strings.HasPrefix(arg, "-ldflags=") || strings.HasPrefix(arg, "ldflags=") {
+			args[i] = strings.TrimSpace(args[i] + " " + flags)
+			return args
+		}
+	}
+	return append(args, "-ldflags", flags)
+}
+
+// addBuildInfo adds the build information of the project (version, commit, date, ...) to the linker
+// flags of the go build arguments, unless build.info.disable is set in the burrow.yaml. The env
+// contains the additional environment variables of the go tool. Every action building binaries uses
+// it, so build, install and run inject the same version.
+func addBuildInfo(args []string, env []string) ([]string, error) {
+	if burrow.Config.Build.Info.Disable {
+		return args, nil
+	}
+	flags, err := burrow.GetBuildInfo(env).LdFlags()
+	if err != nil {
+		return nil, err
+	}
+	return addLdFlags(args, flags), nil
+}
+
+// goCommand returns the command line of the go tool with the given arguments and additional
+// environment variables, as it is shown in the deprecation notice.
+func goCommand(env []string, args []string) []string {
+	command := append([]string{"go"}, args...)
+	if len(env) > 0 {
+		command = append(append([]string{"env"}, env...), command...)
+	}
+	return command
 }
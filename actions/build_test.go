@@ -0,0 +1,81 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		value    string
+		platform platform
+		err      bool
+	}{
+		{"linux/amd64", platform{GOOS: "linux", GOARCH: "amd64"}, false},
+		{"linux/arm/7", platform{GOOS: "linux", GOARCH: "arm", Variant: "7"}, false},
+		{"linux/amd64/v3", platform{GOOS: "linux", GOARCH: "amd64", Variant: "v3"}, false},
+		{"darwin/arm64/v8.2", platform{GOOS: "darwin", GOARCH: "arm64", Variant: "v8.2"}, false},
+		{"windows/wasm/v1", platform{}, true},
+		{"linux", platform{}, true},
+		{"linux/", platform{}, true},
+		{"/amd64", platform{}, true},
+		{"linux/arm/7/extra", platform{}, true},
+		{"", platform{}, true},
+	}
+	for _, test := range tests {
+		p, err := parsePlatform(test.value)
+		if (err != nil) != test.err || p != test.platform {
+			t.Errorf("parsePlatform(%q) = %+v, %v, want %+v (error: %v)", test.value, p, err, test.platform, test.err)
+		}
+		if err == nil && p.String() != test.value {
+			t.Errorf("parsePlatform(%q).String() = %q", test.value, p.String())
+		}
+	}
+}
+
+func TestAddLdFlags(t *testing.T) {
+	tests := []struct {
+		args   []string
+		flags  string
+		result []string
+	}{
+		{[]string{"build"}, "", []string{"build"}},
+		{[]string{"build"}, "-s -w", []string{"build", "-ldflags", "-s -w"}},
+		{[]string{"build", "-ldflags", "-s"}, "-w", []string{"build", "-ldflags", "-s -w"}},
+		{[]string{"build", "--ldflags", "-s"}, "-w", []string{"build", "--ldflags", "-s -w"}},
+		{[]string{"build", "-ldflags=-s"}, "-w", []string{"build", "-ldflags=-s -w"}},
+		{[]string{"build", "-ldflags", "-s", "-ldflags=-X a=b"}, "-w", []string{"build", "-ldflags", "-s", "-ldflags=-X a=b -w"}},
+		{[]string{"build", "-ldflags=-s", "-ldflags", ""}, "-w", []string{"build", "-ldflags=-s", "-ldflags", "-w"}},
+		{[]string{"build", "-ldflags"}, "-w", []string{"build", "-ldflags", "-w"}},
+		{[]string{"build", "-ldflags=-s", "-ldflags"}, "-w", []string{"build", "-ldflags=-s", "-ldflags", "-w"}},
+	}
+	for _, test := range tests {
+		args := append([]string{}, test.args...)
+		result := addLdFlags(args, test.flags)
+		if !reflect.DeepEqual(result, test.result) {
+			t.Errorf("addLdFlags(%q, %q) = %q, want %q", test.args, test.flags, result, test.result)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("addLdFlags(%q, %q) modified its arguments", test.args, test.flags)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// CacheInfo prints the identity of the current project and the cache directory it maps to.
+func CacheInfo(context *cli.Context) error {
+	burrow.LoadConfig()
+
+	project, err := burrow.GetProject()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "cache", "Failed to resolve project: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	cacheDir, err := burrow.GetCacheDir()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "cache", "Failed to access cache directory: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	burrow.Log(burrow.LOG_INFO, "cache", "Project root:    %s", project.Root)
+	burrow.Log(burrow.LOG_INFO, "cache", "Module path:     %s", project.Module)
+	burrow.Log(burrow.LOG_INFO, "cache", "Cache directory: %s", cacheDir)
+
+	return nil
+}
+
+// CacheList lists all cached targets of the current project together with their age, size and
+// whether they are still up-to-date.
+func CacheList(context *cli.Context) error {
+	burrow.LoadConfig()
+
+	entries, err := burrow.ListCacheEntries()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "cache", "Failed to list cache entries: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	if len(entries) == 0 {
+		burrow.Log(burrow.LOG_INFO, "cache", "The cache of this project is empty")
+		return nil
+	}
+
+	table := &strings.Builder{}
+	writer := tabwriter.NewWriter(table, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TARGET\tKEY\tAGE\tSIZE\tSTATUS")
+	for _, entry := range entries {
+		status := "up-to-date"
+		if reason := entry.Status(); reason != "" {
+			status = "stale: " + reason
+		}
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\t%s\n",
+			entry.Cache.Target,
+			entry.Key,
+			formatAge(time.Since(entry.ModTime)),
+			formatSize(entry.Size),
+			status,
+		)
+	}
+	writer.Flush()
+
+	for _, line := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+		burrow.Log(burrow.LOG_INFO, "cache", "%s", line)
+	}
+
+	return nil
+}
+
+// CacheClear removes the cache entries of a target (or all targets) of the current project.
+func CacheClear(context *cli.Context) error {
+	burrow.LoadConfig()
+
+	if len(context.Args()) > 1 {
+		cli.ShowCommandHelp(context, "clear")
+		return nil
+	}
+	target := context.Args().First()
+
+	removed, err := burrow.ClearCache(target)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "cache", "Failed to clear cache: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	burrow.Log(burrow.LOG_INFO, "cache", "Removed %d cache entries", removed)
+	return nil
+}
+
+// CachePrune removes stale cache entries and the caches of deleted projects on this machine.
+func CachePrune(context *cli.Context) error {
+	maxAge, err := burrow.ParseAge(context.String("older-than"))
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "cache", "Failed to parse --older-than: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	removed, err := burrow.PruneCaches(maxAge)
+	for _, path := range removed {
+		burrow.Log(burrow.LOG_INFO, "cache", "Removed %s", path)
+	}
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "cache", "Failed to prune caches: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	burrow.Log(burrow.LOG_INFO, "cache", "Pruned %d cache directories and entries", len(removed))
+	return nil
+}
+
+// CacheServe runs a reference server for a shared remote cache that stores its data in a local
+// directory.
+func CacheServe(context *cli.Context) error {
+	listen := context.String("listen")
+	dir := context.String("dir")
+
+	handler := burrow.NewCacheServer(dir)
+	logged := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		burrow.Log(burrow.LOG_INFO, "cache", "%s %s", r.Method, r.URL.Path)
+		handler.ServeHTTP(w, r)
+	})
+
+	burrow.Log(burrow.LOG_INFO, "cache", "Serving cache from %s on %s", dir, listen)
+	if err := http.ListenAndServe(listen, logged); err != nil {
+		burrow.Log(burrow.LOG_ERR, "cache", "Failed to serve cache: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	return nil
+}
+
+// formatAge formats a duration with the largest fitting unit, e.g. 3d or 12m.
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(age/(24*time.Hour)))
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh", int(age/time.Hour))
+	case age >= time.Minute:
+		return fmt.Sprintf("%dm", int(age/time.Minute))
+	}
+	return fmt.Sprintf("%ds", int(age/time.Second))
+}
+
+// formatSize formats a size in bytes with a binary unit prefix, e.g. 1.5 KiB.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -30,16 +30,14 @@ import (
 // Check checks the code of a burrow project with go vet.
 func Check(context *cli.Context, useSecondLevelArgs bool) error {
 	burrow.LoadConfig()
-
-	outputs := []string{}
-
-	if burrow.IsTargetUpToDate("check", outputs) && !context.Bool("force") {
-		burrow.Log(burrow.LOG_INFO, "check", "Code has already been checked")
-		return nil
+	if err := runPrerequisites(context, "check"); err != nil {
+		return err
 	}
+	return check(context, useSecondLevelArgs)
+}
 
-	burrow.Log(burrow.LOG_INFO, "check", "Checking code")
-
+// check checks the code without running its prerequisites.
+func check(context *cli.Context, useSecondLevelArgs bool) error {
 	args := []string{}
 	args = append(args, "vet", "./...") // ./... is a 'wildcard package'
 	userArgs, err := shellwords.Parse(burrow.Config.Args.Go.Vet)
@@ -52,6 +50,20 @@ func Check(context *cli.Context, useSecondLevelArgs bool) error {
 	if useSecondLevelArgs {
 		args = append(args, burrow.GetSecondLevelArgs()...)
 	}
+
+	target := burrow.Target{
+		Name:   "check",
+		Args:   args,
+		Inputs: burrow.GetPackageInputs("check", nil, true, "./..."),
+	}
+
+	if !context.Bool("force") && burrow.IsTargetUpToDate(target) {
+		burrow.Log(burrow.LOG_INFO, "check", "Code has already been checked")
+		return nil
+	}
+
+	burrow.Log(burrow.LOG_INFO, "check", "Checking code")
+
 	wd, err := os.Getwd()
 	if err != nil {
 		burrow.Log(burrow.LOG_ERR, "check", "Failed to get working directory: %s", err)
@@ -59,7 +71,7 @@ func Check(context *cli.Context, useSecondLevelArgs bool) error {
 	}
 	err = burrow.ExecDir("check", wd, "go", args...)
 	if err == nil {
-		burrow.UpdateTarget("check", outputs)
+		burrow.UpdateTarget(target)
 	}
 
 	burrow.Deprecation("check", append([]string{"go"}, args...))
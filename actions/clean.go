@@ -52,10 +52,24 @@ func Clean(context *cli.Context) error {
 		return os.Remove(path)
 	})
 
+	if err == nil {
+		err = os.RemoveAll(burrow.CoverageDir)
+	}
+
+	if err == nil && context.Bool("cache") {
+		removed, cacheErr := burrow.ClearCache("")
+		if cacheErr != nil {
+			burrow.Log(burrow.LOG_ERR, "clean", "Failed to clear target cache: %s", cacheErr)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		burrow.Log(burrow.LOG_INFO, "clean", "Removed %d target cache entries", removed)
+	}
+
 	deprecationArgs := make([][]string, 0)
 	deprecationArgs = append(deprecationArgs, []string{"go", "clean"})
 	deprecationArgs = append(deprecationArgs, []string{"rm", "-rf", "./bin/*"})
 	deprecationArgs = append(deprecationArgs, []string{"rm", "-rf", "./package/*"})
+	deprecationArgs = append(deprecationArgs, []string{"rm", "-rf", "./" + burrow.CoverageDir})
 
 	burrow.Deprecation("clean", deprecationArgs...)
 
@@ -0,0 +1,145 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// The coverageTestProfile is the coverage profile 'burrow test --cover' writes and the
+// coverageRunDir is the directory the binaries of 'burrow run --cover' write their coverage data to.
+var coverageTestProfile = filepath.Join(burrow.CoverageDir, "data", "test.out")
+var coverageRunDir = filepath.Join(burrow.CoverageDir, "data", "run")
+
+// writeCoverage merges the coverage profile of the tests with the coverage data of all runs of
+// instrumented binaries and writes the text, HTML and Cobertura reports to the coverage directory.
+// An error is returned if the coverage is below the thresholds of the burrow.yaml.
+func writeCoverage() error {
+	profile, err := burrow.ReadCoverProfile(coverageTestProfile)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "coverage", "Failed to read the coverage profile of the tests: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	if files, err := ioutil.ReadDir(coverageRunDir); err == nil && len(files) > 0 {
+		data, err := burrow.ReadCoverageData(coverageRunDir)
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "coverage", "Failed to read the coverage data of %s: %s", coverageRunDir, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		burrow.Log(burrow.LOG_INFO, "coverage", "Merging the coverage data of %s", coverageRunDir)
+		profile.Merge(data)
+	}
+
+	merged := filepath.Join(burrow.CoverageDir, "coverage.out")
+	if err := profile.Write(merged); err != nil {
+		burrow.Log(burrow.LOG_ERR, "coverage", "Failed to write %s: %s", merged, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	html := filepath.Join(burrow.CoverageDir, "index.html")
+	if _, err := burrow.ExecOutput("go", "tool", "cover", "-html="+merged, "-o="+html); err != nil {
+		burrow.Log(burrow.LOG_ERR, "coverage", "Failed to write %s: %s", html, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	functions, err := burrow.ExecOutput("go", "tool", "cover", "-func="+merged)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "coverage", "Failed to read the coverage of the functions: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	packages := profile.Packages()
+	names := []string{}
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	total := profile.Total()
+
+	rows := [][]string{{"PACKAGE", "COVERAGE", "STATEMENTS"}}
+	for _, name := range names {
+		if packages[name].Statements == 0 {
+			continue
+		}
+		rows = append(rows, []string{name, formatCoverage(packages[name]), fmt.Sprintf("%d/%d", packages[name].Covered, packages[name].Statements)})
+	}
+	rows = append(rows, []string{"total", formatCoverage(total), fmt.Sprintf("%d/%d", total.Covered, total.Statements)})
+
+	text := filepath.Join(burrow.CoverageDir, "coverage.txt")
+	err = burrow.WriteFileAtomic(text, 0644, func(w io.Writer) error {
+		for _, row := range rows {
+			if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "\n%s", functions)
+		return err
+	})
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "coverage", "Failed to write %s: %s", text, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	project, err := burrow.GetProject()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "coverage", "Failed to find the project: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	cobertura := filepath.Join(burrow.CoverageDir, "cobertura.xml")
+	if err := profile.WriteCobertura(cobertura, project.Root, project.Module); err != nil {
+		burrow.Log(burrow.LOG_ERR, "coverage", "Failed to write %s: %s", cobertura, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	logTable("coverage", rows)
+	burrow.Log(burrow.LOG_INFO, "coverage", "Wrote coverage reports to %s", burrow.CoverageDir)
+
+	failed := false
+	limits := burrow.Config.Coverage
+	if limits.MinTotal > 0 && total.Percent() < limits.MinTotal {
+		burrow.Log(burrow.LOG_ERR, "coverage", "The total coverage of %s is below %.1f%%", formatCoverage(total), limits.MinTotal)
+		failed = true
+	}
+	if limits.MinPackage > 0 {
+		for _, name := range names {
+			if packages[name].Percent() < limits.MinPackage {
+				burrow.Log(burrow.LOG_ERR, "coverage", "The coverage of %s of %s is below %.1f%%", formatCoverage(packages[name]), name, limits.MinPackage)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	return nil
+}
+
+// formatCoverage formats the coverage in percent.
+func formatCoverage(stats burrow.CoverageStats) string {
+	return fmt.Sprintf("%.1f%%", stats.Percent())
+}
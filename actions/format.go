@@ -28,16 +28,14 @@ import (
 // Format formats the code of the current burrow project with gofmt.
 func Format(context *cli.Context, useSecondLevelArgs bool) error {
 	burrow.LoadConfig()
-
-	outputs := []string{}
-
-	if burrow.IsTargetUpToDate("format", outputs) && !context.Bool("force") {
-		burrow.Log(burrow.LOG_INFO, "format", "Code formatting is up-to-date")
-		return nil
+	if err := runPrerequisites(context, "format"); err != nil {
+		return err
 	}
+	return format(context, useSecondLevelArgs)
+}
 
-	burrow.Log(burrow.LOG_INFO, "format", "Formatting code")
-
+// format formats the code without running its prerequisites.
+func format(context *cli.Context, useSecondLevelArgs bool) error {
 	args := []string{}
 	args = append(args, "fmt", "./...")
 	userArgs, err := shellwords.Parse(burrow.Config.Args.Go.Fmt)
@@ -51,9 +49,22 @@ func Format(context *cli.Context, useSecondLevelArgs bool) error {
 		args = append(args, burrow.GetSecondLevelArgs()...)
 	}
 
+	target := burrow.Target{
+		Name:   "format",
+		Args:   args,
+		Inputs: burrow.GetCodefiles(),
+	}
+
+	if !context.Bool("force") && burrow.IsTargetUpToDate(target) {
+		burrow.Log(burrow.LOG_INFO, "format", "Code formatting is up-to-date")
+		return nil
+	}
+
+	burrow.Log(burrow.LOG_INFO, "format", "Formatting code")
+
 	err = burrow.Exec("format", "go", args...)
 	if err == nil {
-		burrow.UpdateTarget("format", outputs)
+		burrow.UpdateTarget(target)
 	}
 
 	burrow.Deprecation("format", append([]string{"go"}, args...))
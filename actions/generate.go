@@ -0,0 +1,211 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// Generate runs the //go:generate directives of every package of a burrow project with
+// 'go generate'. Packages whose files and generators did not change are skipped.
+func Generate(context *cli.Context, useSecondLevelArgs bool) error {
+	burrow.LoadConfig()
+	if err := runPrerequisites(context, "generate"); err != nil {
+		return err
+	}
+	return generate(context, useSecondLevelArgs)
+}
+
+// generate runs the generators without running the prerequisites.
+func generate(context *cli.Context, useSecondLevelArgs bool) error {
+	packages, err := burrow.ListPackages(nil, "./...")
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "generate", "Failed to list the packages of the project: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "generate", "Failed to get working directory: %s", err)
+		return err
+	}
+
+	generated := 0
+	for _, pkg := range packages {
+		if !pkg.IsLocal() {
+			continue
+		}
+		dir, err := filepath.Rel(wd, pkg.Dir)
+		if err != nil || burrow.IsIgnored(dir) {
+			continue
+		}
+		dir = "./" + filepath.ToSlash(dir)
+		if dir == "./." {
+			dir = "."
+		}
+
+		directives, err := burrow.GetGenerateDirectives(pkg.Files(true))
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "generate", "Failed to read the go:generate directives of %s: %s", dir, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		if len(directives) == 0 {
+			continue
+		}
+
+		args := []string{"generate"}
+		if useSecondLevelArgs {
+			args = append(args, burrow.GetSecondLevelArgs()...)
+		}
+		args = append(args, dir)
+		if err := generatePackage(context, dir, directives, args); err != nil {
+			return err
+		}
+		generated++
+	}
+
+	if generated == 0 {
+		burrow.Log(burrow.LOG_INFO, "generate", "There are no go:generate directives in the project")
+	}
+	return nil
+}
+
+// generatePackage runs 'go generate' with the given args for a single package directory. The
+// generated files of the package are the outputs of its cache target and all other files are
+// inputs. Generated files whose content did not change keep their modification time.
+func generatePackage(context *cli.Context, dir string, directives []burrow.GenerateDirective, args []string) error {
+	target, err := generateTarget(dir, directives, args)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "generate", "Failed to list the files of %s: %s", dir, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	if !context.Bool("force") && burrow.IsTargetUpToDate(target) {
+		burrow.Log(burrow.LOG_INFO, "generate", "Code of %s has already been generated", dir)
+		return nil
+	}
+
+	burrow.Log(burrow.LOG_INFO, "generate", "Generating code of %s", dir)
+
+	before, err := burrow.GetFileStates(target.Outputs)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "generate", "Failed to read the generated files of %s: %s", dir, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	if err := burrow.Exec("generate", "go", args...); err != nil {
+		return err
+	}
+	burrow.Deprecation("generate", append([]string{"go"}, args...))
+
+	target, err = generateTarget(dir, directives, args)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "generate", "Failed to list the files of %s: %s", dir, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	changed := 0
+	for _, file := range target.Outputs {
+		state, err := burrow.GetFileState(file, burrow.FileState{})
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "generate", "Failed to read the generated file %s: %s", file, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		old, ok := before[file]
+		if !ok || old.Hash != state.Hash {
+			changed++
+			continue
+		}
+		if old.Mtime != state.Mtime {
+			mtime := time.Unix(0, old.Mtime)
+			if err := os.Chtimes(file, mtime, mtime); err != nil {
+				burrow.Log(burrow.LOG_WARN, "generate", "Failed to restore the modification time of %s: %s", file, err)
+			}
+		}
+	}
+
+	if changed == 0 {
+		burrow.Log(burrow.LOG_INFO, "generate", "The generated code of %s did not change", dir)
+	} else {
+		burrow.Log(burrow.LOG_INFO, "generate", "Updated %d generated files of %s", changed, dir)
+	}
+	burrow.UpdateTarget(target)
+	return nil
+}
+
+// generateTarget returns the cache target of a package directory. The generated files of the
+// package are its outputs, the other files of the package and the local files of the generators are
+// its inputs, and the generator programs are part of its args.
+func generateTarget(dir string, directives []burrow.GenerateDirective, args []string) (burrow.Target, error) {
+	packages, err := burrow.ListPackages(nil, dir)
+	if err != nil {
+		return burrow.Target{}, err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return burrow.Target{}, err
+	}
+
+	inputs := map[string]bool{}
+	outputs := []string{}
+	for _, pkg := range packages {
+		for _, file := range pkg.Files(true) {
+			if rel, err := filepath.Rel(wd, file); err == nil {
+				file = rel
+			}
+			if burrow.IsGeneratedFile(file) {
+				outputs = append(outputs, file)
+			} else {
+				inputs[file] = true
+			}
+		}
+	}
+
+	keyArgs := append([]string{}, args...)
+	for _, directive := range directives {
+		keyArgs = append(keyArgs, "generator="+directive.GeneratorKey())
+		for _, file := range directive.GeneratorInputs("generate", dir) {
+			inputs[file] = true
+		}
+	}
+	for _, file := range outputs {
+		delete(inputs, file)
+	}
+
+	target := burrow.Target{
+		Name:    "generate",
+		Args:    keyArgs,
+		Inputs:  []string{},
+		Outputs: outputs,
+	}
+	for file := range inputs {
+		target.Inputs = append(target.Inputs, file)
+	}
+	sort.Strings(target.Inputs)
+	sort.Strings(target.Outputs)
+	return target, nil
+}
@@ -0,0 +1,289 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// The step struct describes a node of the action graph. Depends lists the steps that have to run
+// before the step. After lists steps that have to run before the step only if they are part of the
+// same plan anyway.
+type step struct {
+	Run     func(context *cli.Context) error
+	Depends []string
+	After   []string
+}
+
+// The plan struct describes the steps that have to run for a target in topological order and the
+// edges between them.
+type plan struct {
+	Order []string
+	Edges map[string][]string
+}
+
+// getStep returns the step with the given name. Built-in actions take precedence over tasks of the
+// burrow.yaml. The default dependencies of built-in actions are replaced by the depends list in the
+// burrow.yaml if one is given. When generate.enabled is set, generate is a dependency of check, test,
+// bench and build.
+func getStep(name string) (step, bool) {
+	config := burrow.Config
+	var s step
+	var depends []string
+	switch name {
+	case "generate":
+		s = step{Run: func(context *cli.Context) error { return generate(context, false) }}
+		s.After = []string{"format"}
+		depends = config.Generate.Depends
+	case "format":
+		s = step{Run: func(context *cli.Context) error { return format(context, false) }}
+		depends = config.Format.Depends
+	case "check":
+		s = step{Run: func(context *cli.Context) error { return check(context, false) }}
+		s.After = []string{"format"}
+		depends = config.Check.Depends
+	case "test":
+		s = step{Run: func(context *cli.Context) error { return test(context, false) }}
+		s.After = []string{"format"}
+		depends = config.Test.Depends
+	case "bench":
+		s = step{Run: func(context *cli.Context) error { return bench(context, false) }}
+		s.After = []string{"format"}
+		depends = config.Bench.Depends
+	case "build":
+		s = step{Run: func(context *cli.Context) error { return build(context, true) }}
+		s.After = []string{"format"}
+		depends = config.Build.Depends
+	case "install":
+		s = step{Run: install, Depends: []string{"format", "check", "test", "build"}}
+		depends = config.Install.Depends
+	case "package":
+		s = step{Run: packageBinaries, Depends: []string{"format", "check", "test", "build"}}
+		depends = config.Package.Depends
+	case "publish":
+		s = step{Run: func(context *cli.Context) error { return publish(context, false) }}
+		s.Depends = []string{"package"}
+		depends = config.Publish.Depends
+	default:
+		task, ok := config.Tasks[name]
+		if !ok {
+			return step{}, false
+		}
+		return step{
+			Run:     func(context *cli.Context) error { return runTask(context, name, false) },
+			Depends: task.Depends,
+		}, true
+	}
+	if depends != nil {
+		s.Depends = depends
+	}
+	if config.Generate.Enabled && (name == "check" || name == "test" || name == "bench" || name == "build") && !contains(s.Depends, "generate") {
+		s.Depends = append(append([]string{}, s.Depends...), "generate")
+	}
+	return s, true
+}
+
+// resolvePlan collects all steps the target depends on and sorts them topologically. An error is
+// returned for unknown steps and dependency cycles.
+func resolvePlan(target string) (plan, error) {
+	steps := map[string]step{}
+	var collect func(name string) error
+	collect = func(name string) error {
+		if _, ok := steps[name]; ok {
+			return nil
+		}
+		s, ok := getStep(name)
+		if !ok {
+			return fmt.Errorf("there is no action or task named '%s'", name)
+		}
+		steps[name] = s
+		for _, dep := range s.Depends {
+			if err := collect(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := collect(target); err != nil {
+		return plan{}, err
+	}
+
+	p := plan{Edges: map[string][]string{}}
+	for name, s := range steps {
+		edges := append([]string{}, s.Depends...)
+		for _, after := range s.After {
+			if _, ok := steps[after]; ok && !contains(edges, after) {
+				edges = append(edges, after)
+			}
+		}
+		p.Edges[name] = edges
+	}
+
+	state := map[string]int{}
+	path := []string{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("dependency cycle %s", strings.Join(cycle, " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		path = append(path, name)
+		for _, dep := range p.Edges[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = 2
+		p.Order = append(p.Order, name)
+		return nil
+	}
+	if err := visit(target); err != nil {
+		return plan{}, err
+	}
+	return p, nil
+}
+
+// Stages groups the steps of a plan into stages. All steps of a stage only depend on steps of
+// earlier stages and may run in parallel.
+func (p plan) Stages() [][]string {
+	level := map[string]int{}
+	stages := [][]string{}
+	for _, name := range p.Order {
+		for _, dep := range p.Edges[name] {
+			if level[dep]+1 > level[name] {
+				level[name] = level[dep] + 1
+			}
+		}
+		if level[name] == len(stages) {
+			stages = append(stages, []string{})
+		}
+		stages[level[name]] = append(stages[level[name]], name)
+	}
+	for _, stage := range stages {
+		sort.Strings(stage)
+	}
+	return stages
+}
+
+// runPrerequisites runs all steps the target depends on. Steps that do not depend on each other are
+// run in parallel. After the first failure no further steps are started.
+func runPrerequisites(context *cli.Context, target string) error {
+	p, err := resolvePlan(target)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, target, "Failed to resolve dependencies: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	done := map[string]chan struct{}{}
+	for _, name := range p.Order {
+		done[name] = make(chan struct{})
+	}
+
+	var mutex sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for _, name := range p.Order {
+		if name == target {
+			continue
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer close(done[name])
+			for _, dep := range p.Edges[name] {
+				<-done[dep]
+			}
+
+			mutex.Lock()
+			failed := firstErr != nil
+			mutex.Unlock()
+			if failed {
+				return
+			}
+
+			s, _ := getStep(name)
+			if err := s.Run(context); err != nil {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mutex.Unlock()
+			}
+		}(name)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Graph prints the steps that are run for a target grouped into stages.
+func Graph(context *cli.Context) error {
+	burrow.LoadConfig()
+
+	target := context.Args().First()
+	if target == "" {
+		target = "package"
+	}
+
+	p, err := resolvePlan(target)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "graph", "Failed to resolve dependencies: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	burrow.Log(burrow.LOG_INFO, "graph", "Plan for %s:", target)
+	for i, stage := range p.Stages() {
+		names := []string{}
+		for _, name := range stage {
+			edges := append([]string{}, p.Edges[name]...)
+			sort.Strings(edges)
+			if len(edges) > 0 {
+				name += " (after " + strings.Join(edges, ", ") + ")"
+			}
+			names = append(names, name)
+		}
+		burrow.Log(burrow.LOG_INFO, "graph", "  stage %d: %s", i+1, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// contains returns whether the list contains the value.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
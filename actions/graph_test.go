@@ -0,0 +1,141 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+)
+
+func TestResolvePlan(t *testing.T) {
+	defer func() { burrow.Config = burrow.Configuration{} }()
+
+	tests := []struct {
+		name   string
+		config func(config *burrow.Configuration)
+		target string
+		order  []string
+		stages [][]string
+		err    string
+	}{
+		{
+			name:   "without dependencies",
+			config: func(config *burrow.Configuration) {},
+			target: "build",
+			order:  []string{"build"},
+			stages: [][]string{{"build"}},
+		},
+		{
+			name:   "default dependencies",
+			config: func(config *burrow.Configuration) {},
+			target: "install",
+			order:  []string{"format", "check", "test", "build", "install"},
+			stages: [][]string{{"format"}, {"build", "check", "test"}, {"install"}},
+		},
+		{
+			name: "replaced dependencies",
+			config: func(config *burrow.Configuration) {
+				config.Install.Depends = []string{"build"}
+			},
+			target: "install",
+			order:  []string{"build", "install"},
+			stages: [][]string{{"build"}, {"install"}},
+		},
+		{
+			name: "tasks",
+			config: func(config *burrow.Configuration) {
+				config.Build.Depends = []string{"codegen"}
+				config.Tasks = map[string]burrow.Task{
+					"codegen": {Depends: []string{"protoc"}},
+					"protoc":  {},
+				}
+			},
+			target: "build",
+			order:  []string{"protoc", "codegen", "build"},
+			stages: [][]string{{"protoc"}, {"codegen"}, {"build"}},
+		},
+		{
+			name: "shared dependency",
+			config: func(config *burrow.Configuration) {
+				config.Tasks = map[string]burrow.Task{
+					"all":  {Depends: []string{"lint", "vet"}},
+					"lint": {Depends: []string{"deps"}},
+					"vet":  {Depends: []string{"deps"}},
+					"deps": {},
+				}
+			},
+			target: "all",
+			order:  []string{"deps", "lint", "vet", "all"},
+			stages: [][]string{{"deps"}, {"lint", "vet"}, {"all"}},
+		},
+		{
+			name: "cycle",
+			config: func(config *burrow.Configuration) {
+				config.Build.Depends = []string{"codegen"}
+				config.Tasks = map[string]burrow.Task{
+					"codegen": {Depends: []string{"protoc"}},
+					"protoc":  {Depends: []string{"build"}},
+				}
+			},
+			target: "build",
+			err:    "dependency cycle build -> codegen -> protoc -> build",
+		},
+		{
+			name: "self dependency",
+			config: func(config *burrow.Configuration) {
+				config.Tasks = map[string]burrow.Task{"loop": {Depends: []string{"loop"}}}
+			},
+			target: "loop",
+			err:    "dependency cycle loop -> loop",
+		},
+		{
+			name: "unknown step",
+			config: func(config *burrow.Configuration) {
+				config.Build.Depends = []string{"missing"}
+			},
+			target: "build",
+			err:    "there is no action or task named 'missing'",
+		},
+	}
+	for _, test := range tests {
+		burrow.Config = burrow.Configuration{}
+		test.config(&burrow.Config)
+
+		p, err := resolvePlan(test.target)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: resolvePlan error = %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: resolvePlan failed: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(p.Order, test.order) {
+			t.Errorf("%s: order = %v, want %v", test.name, p.Order, test.order)
+		}
+		if stages := p.Stages(); !reflect.DeepEqual(stages, test.stages) {
+			t.Errorf("%s: stages = %v, want %v", test.name, stages, test.stages)
+		}
+	}
+}
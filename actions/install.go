@@ -20,6 +20,9 @@
 package burrow
 
 import (
+	"path"
+	"strings"
+
 	"github.com/EmbeddedEnterprises/burrow/utils"
 	"github.com/mattn/go-shellwords"
 	"github.com/urfave/cli"
@@ -28,41 +31,80 @@ import (
 // Install installs the application in the GOPATH.
 func Install(context *cli.Context) error {
 	burrow.LoadConfig()
-	if err := Format(context, false); err != nil {
+	if err := runPrerequisites(context, "install"); err != nil {
 		return err
 	}
-	if err := Check(context, false); err != nil {
+	return install(context)
+}
+
+// install installs the application without running its prerequisites.
+func install(context *cli.Context) error {
+	args := []string{}
+	args = append(args, "install")
+	userArgs, err := shellwords.Parse(burrow.Config.Args.Go.Build)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "install", "Failed to read user arguments from config file: %s", err)
 		return err
 	}
-	if err := Test(context, false); err != nil {
-		return err
+	args = append(args, userArgs...)
+
+	profile, err := burrow.GetProfile(context.String("profile"))
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "install", "Failed to read profile: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
 	}
-	if err := Build(context, true); err != nil {
-		return err
+	env := profile.Environ()
+	profileArgs, err := profile.Args()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "install", "Failed to read the flags of profile %s: %s", profile.Name, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	args = append(args, profileArgs...)
+	args = addLdFlags(args, profile.Ldflags)
+	if err := burrow.GenerateBuildInfoPackage(); err != nil {
+		burrow.Log(burrow.LOG_ERR, "install", "Failed to generate the buildinfo package: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	args, err = addBuildInfo(args, env)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "install", "Failed to read the build information: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	root := burrow.Binary{Package: "."}
+	args = append(args, root.PgoArgs(profile.Pgo)...)
+	tags := []string{}
+	if len(profile.Tags) > 0 {
+		tags = []string{"-tags", strings.Join(profile.Tags, ",")}
+		args = append(args, tags...)
 	}
 
-	outputs := []string{}
+	name := "install"
+	if profile.Name != "" {
+		name += "-" + profile.Name
+	}
+	inputs := burrow.GetPackageInputs("install", env, false, append(tags, ".")...)
+	if file, ok := root.PgoFile(); ok && profile.Pgo {
+		inputs = append(inputs, path.Clean(file))
+	}
+	target := burrow.Target{
+		Name:   name,
+		Args:   args,
+		Env:    env,
+		Inputs: inputs,
+	}
 
-	if burrow.IsTargetUpToDate("install", outputs) && !context.Bool("force") {
+	if !context.Bool("force") && burrow.IsTargetUpToDate(target) {
 		burrow.Log(burrow.LOG_INFO, "install", "Installation is up-to-date")
 		return nil
 	}
 	burrow.Log(burrow.LOG_INFO, "install", "Installing application in GOPATH")
 
-	args := []string{}
-	args = append(args, "install")
-	userArgs, err := shellwords.Parse(burrow.Config.Args.Go.Build)
-	if err != nil {
-		burrow.Log(burrow.LOG_ERR, "install", "Failed to read user arguments from config file: %s", err)
-		return err
-	}
-	args = append(args, userArgs...)
-	err = burrow.Exec("install", "go", args...)
+	err = burrow.ExecEnv("install", "", env, "go", args...)
 	if err == nil {
-		burrow.UpdateTarget("install", outputs)
+		burrow.UpdateTarget(target)
 	}
 
-	burrow.Deprecation("install", append([]string{"go"}, args...))
+	burrow.Deprecation("install", goCommand(env, args))
 
 	return err
 }
@@ -22,6 +22,7 @@ package burrow
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/EmbeddedEnterprises/burrow/utils"
@@ -31,45 +32,89 @@ import (
 // Package creates a .tar.gz containing the binary.
 func Package(context *cli.Context) error {
 	burrow.LoadConfig()
-	_ = os.Mkdir("./package", 0755)
-	if err := Format(context, false); err != nil {
-		return err
-	}
-	if err := Check(context, false); err != nil {
-		return err
-	}
-	if err := Test(context, false); err != nil {
+	if err := runPrerequisites(context, "package"); err != nil {
 		return err
 	}
-	if err := Build(context, true); err != nil {
-		return err
-	}
-
-	outputs := []string{fmt.Sprintf("./package/%s-%s.tar.gz", burrow.Config.Name, burrow.Config.Version)}
+	return packageBinaries(context)
+}
 
-	if burrow.IsTargetUpToDate("package", outputs) && !context.Bool("force") {
-		burrow.Log(burrow.LOG_INFO, "package", "Package is up-to-date")
-		return nil
-	}
+// packageBinaries creates the .tar.gz without running the prerequisites of the package action.
+func packageBinaries(context *cli.Context) error {
+	_ = os.Mkdir("./package", 0755)
 
-	burrow.Log(burrow.LOG_INFO, "package", "Packaging project")
+	outputs := []string{fmt.Sprintf("./package/%s-%s.tar.gz", burrow.Config.Name, burrow.Config.Version)}
 
-	args := []string{}
-	args = append(args, "czf", outputs[0])
+	files := []string{}
 	_ = filepath.Walk("./bin", func(path string, f os.FileInfo, err error) error {
 		if !f.IsDir() {
-			args = append(args, path)
+			files = append(files, path)
 		}
 		return nil
 	})
-	args = append(args, burrow.Config.Package.Include...)
+	files = append(files, burrow.Config.Package.Include...)
+
+	inputs := []string{}
+	for _, file := range files {
+		_ = filepath.Walk(file, func(path string, f os.FileInfo, err error) error {
+			if err == nil && !f.IsDir() {
+				inputs = append(inputs, path)
+			}
+			return nil
+		})
+	}
+
+	args := []string{}
+	args = append(args, "czf", outputs[0])
+	args = append(args, files...)
+
+	target := burrow.Target{
+		Name:    "package",
+		Args:    args,
+		Inputs:  inputs,
+		Outputs: outputs,
+	}
+
+	if !context.Bool("force") && burrow.IsTargetUpToDate(target) {
+		burrow.Log(burrow.LOG_INFO, "package", "Package is up-to-date")
+		return writePackageManifest(outputs[0], inputs, args)
+	}
+
+	burrow.Log(burrow.LOG_INFO, "package", "Packaging project")
 
 	err := burrow.Exec("package", "tar", args...)
-	if err == nil {
-		burrow.UpdateTarget("package", outputs)
+	if err != nil {
+		return err
 	}
+	burrow.UpdateTarget(target)
 
 	burrow.Deprecation("package", append([]string{"tar"}, args...))
 
-	return err
+	return writePackageManifest(outputs[0], inputs, args)
+}
+
+// writePackageManifest records the package and the digests of the packaged files in the
+// package/manifest.json.
+func writePackageManifest(file string, contents []string, args []string) error {
+	artifact, err := burrow.NewArtifact(file, append([]string{"tar"}, args...))
+	if err == nil {
+		for _, content := range contents {
+			hash, hashErr := burrow.HashFile(content)
+			if hashErr != nil {
+				err = hashErr
+				break
+			}
+			artifact.Contents = append(artifact.Contents, burrow.Content{
+				Path:   path.Clean(filepath.ToSlash(content)),
+				SHA256: hash,
+			})
+		}
+	}
+	if err == nil {
+		err = burrow.WriteManifest("./package/manifest.json", []burrow.Artifact{artifact})
+	}
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "package", "Failed to write package/manifest.json: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	return nil
 }
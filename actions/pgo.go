@@ -0,0 +1,212 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// PgoCollect collects CPU profiles of benchmarks or of the running application and merges them into
+// the default.pgo of a main package, which is used for profile-guided optimization by 'go build'.
+func PgoCollect(context *cli.Context, useSecondLevelArgs bool) error {
+	burrow.LoadConfig()
+
+	bench := context.String("bench")
+	address := context.String("url")
+	if bench == "" && address == "" {
+		burrow.Log(burrow.LOG_ERR, "pgo", "Collect profiles of benchmarks with --bench or of the application with --url")
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	binaries, err := burrow.GetBinaries()
+	if err != nil || len(binaries) == 0 {
+		burrow.Log(burrow.LOG_ERR, "pgo", "Failed to find the main packages of the project: %v", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	name := context.String("binary")
+	if name == "" {
+		name = burrow.Config.Name
+	}
+	binary, ok := burrow.FindBinary(binaries, name)
+	if !ok {
+		if context.String("binary") != "" {
+			burrow.Log(burrow.LOG_ERR, "pgo", "There is no binary named '%s'", name)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		binary = binaries[0]
+	}
+	output := filepath.Join(binary.PackageDir(), "default.pgo")
+
+	dir, err := ioutil.TempDir("", "burrow-pgo-")
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "pgo", "Failed to create a temporary directory: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	defer os.RemoveAll(dir)
+
+	profiles := []string{}
+	if bench != "" {
+		packages := context.StringSlice("package")
+		if len(packages) == 0 {
+			packages = []string{binary.PackageDir()}
+		}
+		for i, pkg := range packages {
+			profile := filepath.Join(dir, fmt.Sprintf("bench-%d.pprof", i))
+			args := []string{
+				"test", "-run", "^$", "-bench", bench, "-benchtime", context.String("benchtime"),
+				"-cpuprofile", profile, "-o", filepath.Join(dir, fmt.Sprintf("bench-%d.test", i)), pkg,
+			}
+			burrow.Log(burrow.LOG_INFO, "pgo", "Profiling benchmarks of %s", pkg)
+			if err := burrow.Exec("pgo", "go", args...); err != nil {
+				return err
+			}
+			burrow.Deprecation("pgo", append([]string{"go"}, args...))
+			profiles = append(profiles, profile)
+		}
+	}
+
+	if address != "" {
+		profile := filepath.Join(dir, "application.pprof")
+		args := []string{}
+		if useSecondLevelArgs {
+			args = burrow.GetSecondLevelArgs()
+		}
+		if err := profileApplication(context, binary, address, args, profile); err != nil {
+			return err
+		}
+		profiles = append(profiles, profile)
+	}
+
+	if context.Bool("append") {
+		if _, err := os.Stat(output); err == nil {
+			profiles = append(profiles, output)
+		}
+	}
+
+	args := append([]string{"tool", "pprof", "-proto"}, profiles...)
+	merged, err := burrow.ExecOutput("go", args...)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "pgo", "Failed to merge the profiles: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	err = burrow.WriteFileAtomic(output, 0644, func(w io.Writer) error {
+		_, err := w.Write(merged)
+		return err
+	})
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "pgo", "Failed to write %s: %s", output, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	burrow.Log(burrow.LOG_INFO, "pgo", "Merged %d profiles into %s", len(profiles), output)
+	burrow.Deprecation("pgo", append(append([]string{"go"}, args...), ">", output))
+	return nil
+}
+
+// profileApplication builds the binary for the host and starts it and downloads a CPU profile from
+// its net/http/pprof endpoint (address) to the file. The application is stopped afterwards. The
+// binary is always built for the host, even if build.platforms lists other platforms.
+func profileApplication(context *cli.Context, binary burrow.Binary, address string, args []string, file string) error {
+	if err := runPrerequisites(context, "build"); err != nil {
+		return err
+	}
+	if err := burrow.GenerateBuildInfoPackage(); err != nil {
+		burrow.Log(burrow.LOG_ERR, "pgo", "Failed to generate the buildinfo package: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	profile := burrow.Profile{}
+	if _, err := buildPlatform(context, profile, nil, []burrow.Binary{binary}, false); err != nil {
+		return err
+	}
+
+	seconds := context.Int("seconds")
+	endpoint, err := url.Parse(address)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "pgo", "Invalid profile url '%s': %s", address, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	if endpoint.Query().Get("seconds") == "" {
+		query := endpoint.Query()
+		query.Set("seconds", strconv.Itoa(seconds))
+		endpoint.RawQuery = query.Encode()
+	}
+
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	defer cancel()
+	executable := outputPath(profile, nil, binary)
+	done := make(chan error, 1)
+	go func() {
+		done <- burrow.ExecContext(ctx, "pgo", "", nil, executable, args...)
+	}()
+
+	burrow.Log(burrow.LOG_INFO, "pgo", "Profiling %s for %d seconds", binary.Name, seconds)
+	client := &http.Client{Timeout: time.Duration(seconds+30) * time.Second}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		select {
+		case err := <-done:
+			burrow.Log(burrow.LOG_ERR, "pgo", "The application stopped before it was profiled: %v", err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		default:
+		}
+
+		err = downloadProfile(client, endpoint.String(), file)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			burrow.Log(burrow.LOG_ERR, "pgo", "Failed to download the profile from %s: %s", endpoint, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	return nil
+}
+
+// downloadProfile writes the response of a GET request to the url to the file.
+func downloadProfile(client *http.Client, address string, file string) error {
+	response, err := client.Get(address)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return burrow.WriteFileAtomic(file, 0644, func(w io.Writer) error {
+		_, err := io.Copy(w, response.Body)
+		return err
+	})
+}
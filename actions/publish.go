@@ -20,6 +20,8 @@
 package burrow
 
 import (
+	"fmt"
+
 	"github.com/EmbeddedEnterprises/burrow/utils"
 	"github.com/mattn/go-shellwords"
 	"github.com/urfave/cli"
@@ -28,11 +30,22 @@ import (
 // Publish builds the application, packages the application and creates a new version tag in git.
 func Publish(context *cli.Context, useSecondLevelArgs bool) error {
 	burrow.LoadConfig()
-	if err := Package(context); err != nil {
+	if err := runPrerequisites(context, "publish"); err != nil {
 		return err
 	}
+	return publish(context, useSecondLevelArgs)
+}
+
+// publish creates the version tag without running the prerequisites of the publish action.
+func publish(context *cli.Context, useSecondLevelArgs bool) error {
 	burrow.Log(burrow.LOG_INFO, "publish", "Publishing new version tag in git")
 
+	if err := checkPackageManifest(); err != nil {
+		burrow.Log(burrow.LOG_ERR, "publish", "The package manifest is stale: %s", err)
+		burrow.Log(burrow.LOG_ERR, "publish", "Run 'burrow package' to update it.")
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
 	err := burrow.Exec("publish", "git", "diff-index", "--quiet", "HEAD", "--")
 	if err != nil {
 		burrow.Log(burrow.LOG_ERR, "publish", "You have unstaged changes, commit them to proceed!")
@@ -59,3 +72,21 @@ func Publish(context *cli.Context, useSecondLevelArgs bool) error {
 
 	return err
 }
+
+// checkPackageManifest checks that the package/manifest.json describes the package of the current
+// version and that neither the package nor the packaged files changed since it was written.
+func checkPackageManifest() error {
+	file := fmt.Sprintf("./package/%s-%s.tar.gz", burrow.Config.Name, burrow.Config.Version)
+	manifest, err := burrow.ReadManifest("./package/manifest.json")
+	if err != nil {
+		return err
+	}
+	artifact, ok := manifest.Find(file)
+	if !ok {
+		return fmt.Errorf("%s is not part of the manifest", file)
+	}
+	if artifact.Version != burrow.Config.Version {
+		return fmt.Errorf("%s was packaged for version %s", file, artifact.Version)
+	}
+	return artifact.Verify()
+}
@@ -20,6 +20,10 @@
 package burrow
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/EmbeddedEnterprises/burrow/utils"
 	"github.com/mattn/go-shellwords"
 	"github.com/urfave/cli"
@@ -37,29 +41,87 @@ func Run(context *cli.Context, useSecondLevelArgs bool) error {
 		return err
 	}
 
+	profile, err := burrow.GetProfile(context.String("profile"))
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "run", "Failed to read profile: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	profileArgs, err := profile.Args()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "run", "Failed to read the flags of profile %s: %s", profile.Name, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	env := profile.Environ()
+
+	if err := burrow.GenerateBuildInfoPackage(); err != nil {
+		burrow.Log(burrow.LOG_ERR, "run", "Failed to generate the buildinfo package: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
 	args := []string{}
 	args = append(args, "run")
+	if context.Bool("cover") {
+		dir, err := filepath.Abs(coverageRunDir)
+		if err == nil {
+			err = os.MkdirAll(dir, 0755)
+		}
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "run", "Failed to create the coverage directory: %s", err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		args = append(args, burrow.CoverageArgs()...)
+		env = append(env, "GOCOVERDIR="+dir)
+	}
 	args = append(args, userArgs...)
+	args = append(args, profileArgs...)
+	args = addLdFlags(args, profile.Ldflags)
 
 	if useSecondLevelArgs {
 		args = append(args, burrow.GetSecondLevelArgs()...)
 	}
+	args, err = addBuildInfo(args, env)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "run", "Failed to read the build information: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
 
 	if example == "" {
 		burrow.Log(burrow.LOG_INFO, "run", "Running project")
+		if len(profile.Tags) > 0 {
+			args = append(args, "-tags", strings.Join(profile.Tags, ","))
+		}
+		args = append(args, burrow.Binary{Package: "."}.PgoArgs(profile.Pgo)...)
 		args = append(args, ".")
-		err = burrow.Exec("", "go", args...)
+		err = burrow.ExecEnv("", "", env, "go", args...)
 
-		burrow.Deprecation("run", append([]string{"go"}, args...))
+		burrow.Deprecation("run", goCommand(env, args))
 
 		return err
 	}
 
+	binaries, err := burrow.GetBinaries()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "run", "Failed to find the binaries of the project: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	binary, ok := burrow.FindBinary(binaries, example)
+	if !ok {
+		burrow.Log(burrow.LOG_ERR, "run", "There is no example or binary named '%s'", example)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	binaryArgs, err := binary.BuildArgs(profile.Tags...)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "run", "Failed to read the flags of binary %s: %s", binary.Name, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
 	burrow.Log(burrow.LOG_INFO, "run", "Running example %s", example)
-	args = append(args, "./example/"+example+".go")
-	err = burrow.Exec("", "go", args...)
+	args = append(args[:1], append(binaryArgs, args[1:]...)...)
+	args = append(args, binary.PgoArgs(profile.Pgo)...)
+	args = append(args, binary.Package)
+	err = burrow.ExecEnv("", "", env, "go", args...)
 
-	burrow.Deprecation("run", append([]string{"go"}, args...))
+	burrow.Deprecation("run", goCommand(env, args))
 
 	return err
 }
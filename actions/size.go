@@ -0,0 +1,242 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// Size builds the application and reports how much the packages and symbols of every binary
+// contribute to its size. If there is a stored baseline, the binary is compared against it and the
+// action fails when the growth exceeds the size.maxgrowth of the burrow.yaml.
+func Size(context *cli.Context) error {
+	burrow.LoadConfig()
+
+	var limit *burrow.SizeLimit
+	if burrow.Config.Size.MaxGrowth != "" {
+		parsed, err := burrow.ParseSizeLimit(burrow.Config.Size.MaxGrowth)
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "size", "Failed to read size.maxgrowth from config file: %s", err)
+			return cli.NewExitError("", burrow.EXIT_CONFIG)
+		}
+		limit = &parsed
+	}
+
+	if err := Build(context, false); err != nil {
+		return err
+	}
+
+	binaries, err := getBuildOutputs(context)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "size", "Failed to find the binaries of the project: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	top := context.Int("top")
+	if top < 1 {
+		top = 10
+	}
+
+	exceeded := false
+	for _, binary := range binaries {
+		hasSymbols, err := burrow.HasSymbols(binary)
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "size", "Failed to read %s: %s", binary, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		var symbols []burrow.Symbol
+		if hasSymbols {
+			symbols, err = burrow.ReadSymbols(binary)
+		} else {
+			burrow.Log(
+				burrow.LOG_WARN, "size", "%s has no symbol table, its profile links it with -s -w (like the release profile)",
+				binary,
+			)
+			burrow.Log(burrow.LOG_WARN, "size", "Showing the sizes of its sections instead of its packages and symbols")
+			symbols, err = burrow.ReadSections(binary)
+		}
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "size", "Failed to read the symbols of %s: %s", binary, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		report, err := burrow.NewSizeReport(binary, symbols)
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "size", "Failed to read the size of %s: %s", binary, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		report.Stripped = !hasSymbols
+		baseline, hasBaseline, err := burrow.ReadSizeBaseline(binary)
+		if err != nil {
+			burrow.Log(burrow.LOG_WARN, "size", "Ignoring unreadable size baseline of %s: %s", binary, err)
+		}
+
+		if hasBaseline {
+			burrow.Log(
+				burrow.LOG_INFO, "size", "%s: %s (%s since %s)",
+				report.Binary, formatSize(report.Size), formatGrowth(baseline.Size, report.Size), baseline.Version,
+			)
+		} else {
+			burrow.Log(burrow.LOG_INFO, "size", "%s: %s", report.Binary, formatSize(report.Size))
+		}
+
+		// packages and sections cannot be compared, only the size of the whole binary
+		comparable := hasBaseline && baseline.Stripped == report.Stripped
+		kind := "PACKAGE"
+		if report.Stripped {
+			kind = "SECTION"
+		}
+		packages := sortedBySize(report.Packages)
+		rows := [][]string{{kind, "SIZE"}}
+		if comparable {
+			rows[0] = append(rows[0], "CHANGE")
+		}
+		for i, pkg := range packages {
+			if i == top {
+				break
+			}
+			row := []string{pkg, formatSize(report.Packages[pkg])}
+			if comparable {
+				row = append(row, formatChange(report.Packages[pkg]-baseline.Packages[pkg]))
+			}
+			rows = append(rows, row)
+		}
+		logTable("size", rows)
+
+		if comparable {
+			changes := map[string]int64{}
+			for pkg, size := range report.Packages {
+				changes[pkg] = size - baseline.Packages[pkg]
+			}
+			for pkg, size := range baseline.Packages {
+				if _, ok := report.Packages[pkg]; !ok {
+					changes[pkg] = -size
+				}
+			}
+			rows = [][]string{{"LARGEST CHANGES", "SIZE", "CHANGE"}}
+			for _, pkg := range sortedByChange(changes) {
+				if len(rows) > top || changes[pkg] == 0 {
+					break
+				}
+				rows = append(rows, []string{pkg, formatSize(report.Packages[pkg]), formatChange(changes[pkg])})
+			}
+			if len(rows) > 1 {
+				logTable("size", rows)
+			}
+		}
+
+		if !report.Stripped {
+			rows = [][]string{{"SYMBOL", "SIZE", "TYPE"}}
+			for i, symbol := range symbols {
+				if i == top {
+					break
+				}
+				rows = append(rows, []string{symbol.Name, formatSize(symbol.Size), symbol.Type})
+			}
+			logTable("size", rows)
+		}
+
+		if hasBaseline && limit != nil && limit.Exceeded(baseline.Size, report.Size) {
+			burrow.Log(
+				burrow.LOG_ERR, "size", "%s grew by %s, which exceeds the limit of %s",
+				report.Binary, formatGrowth(baseline.Size, report.Size), burrow.Config.Size.MaxGrowth,
+			)
+			exceeded = true
+		}
+
+		if context.Bool("update-baseline") {
+			if err := burrow.WriteSizeBaseline(report); err != nil {
+				burrow.Log(burrow.LOG_ERR, "size", "Failed to store the size baseline of %s: %s", binary, err)
+				return cli.NewExitError("", burrow.EXIT_ACTION)
+			}
+			burrow.Log(burrow.LOG_INFO, "size", "Stored %s as size baseline of version %s", formatSize(report.Size), report.Version)
+		}
+	}
+
+	if exceeded {
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	return nil
+}
+
+// sortedBySize returns the keys of a size map sorted by descending size.
+func sortedBySize(sizes map[string]int64) []string {
+	keys := make([]string, 0, len(sizes))
+	for key := range sizes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if sizes[keys[i]] != sizes[keys[j]] {
+			return sizes[keys[i]] > sizes[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// sortedByChange returns the keys of a map of size changes sorted by the descending absolute change.
+func sortedByChange(changes map[string]int64) []string {
+	abs := map[string]int64{}
+	for key, change := range changes {
+		if change < 0 {
+			change = -change
+		}
+		abs[key] = change
+	}
+	return sortedBySize(abs)
+}
+
+// formatChange formats a size change with its sign, e.g. +1.5 KiB.
+func formatChange(change int64) string {
+	switch {
+	case change > 0:
+		return "+" + formatSize(change)
+	case change < 0:
+		return "-" + formatSize(-change)
+	}
+	return "0 B"
+}
+
+// formatGrowth formats the change from a baseline size in bytes and percent.
+func formatGrowth(baseline int64, size int64) string {
+	if baseline == 0 {
+		return formatChange(size - baseline)
+	}
+	return fmt.Sprintf("%s, %+.1f%%", formatChange(size-baseline), float64(size-baseline)*100/float64(baseline))
+}
+
+// logTable logs the rows as a table with aligned columns. The first row is the header.
+func logTable(target string, rows [][]string) {
+	table := &strings.Builder{}
+	writer := tabwriter.NewWriter(table, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(writer, "  "+strings.Join(row, "\t"))
+	}
+	writer.Flush()
+
+	for _, line := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+		burrow.Log(burrow.LOG_INFO, target, "%s", strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,123 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"sort"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// Task runs a task defined in the burrow.yaml. Without a task name all available tasks are listed.
+func Task(context *cli.Context, useSecondLevelArgs bool) error {
+	burrow.LoadConfig()
+
+	name := context.Args().First()
+	if name == "" || name == "--" {
+		listTasks()
+		return nil
+	}
+
+	if _, ok := burrow.Config.Tasks[name]; !ok {
+		burrow.Log(burrow.LOG_ERR, "task", "There is no task named '%s' in the burrow.yaml", name)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	if err := runPrerequisites(context, name); err != nil {
+		return err
+	}
+	return runTask(context, name, useSecondLevelArgs)
+}
+
+// runTask runs the commands of a task unless the cached state of the task is up-to-date.
+func runTask(context *cli.Context, name string, useSecondLevelArgs bool) error {
+	task := burrow.Config.Tasks[name]
+
+	args := []string{}
+	if useSecondLevelArgs {
+		args = burrow.GetSecondLevelArgs()
+	}
+
+	env := []string{}
+	for key, value := range task.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+
+	key := []string{"dir=" + task.Dir}
+	for _, command := range task.Commands {
+		key = append(key, "command="+command)
+	}
+	for _, val := range env {
+		key = append(key, "env="+val)
+	}
+	for _, arg := range args {
+		key = append(key, "arg="+arg)
+	}
+
+	target := burrow.Target{
+		Name:    "task-" + name,
+		Args:    key,
+		Inputs:  burrow.ExpandPatterns(task.Inputs),
+		Outputs: burrow.ExpandOutputPatterns(task.Outputs),
+	}
+	cacheable := len(task.Inputs) > 0
+
+	if cacheable && !context.Bool("force") && burrow.IsTargetUpToDate(target) {
+		burrow.Log(burrow.LOG_INFO, name, "Task is up-to-date")
+		return nil
+	}
+
+	burrow.Log(burrow.LOG_INFO, name, "Running task")
+
+	for _, command := range task.Commands {
+		burrow.Deprecation(name, []string{command})
+		if err := burrow.ExecShell(name, task.Dir, env, command, args...); err != nil {
+			return err
+		}
+	}
+
+	if cacheable {
+		target.Outputs = burrow.ExpandOutputPatterns(task.Outputs)
+		burrow.UpdateTarget(target)
+	}
+
+	return nil
+}
+
+// listTasks logs the names and descriptions of all tasks defined in the burrow.yaml.
+func listTasks() {
+	if len(burrow.Config.Tasks) == 0 {
+		burrow.Log(burrow.LOG_INFO, "task", "There are no tasks defined in the burrow.yaml")
+		return
+	}
+
+	names := []string{}
+	for name := range burrow.Config.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	burrow.Log(burrow.LOG_INFO, "task", "Available tasks:")
+	for _, name := range names {
+		burrow.Log(burrow.LOG_INFO, "task", "    %-16s %s", name, burrow.Config.Tasks[name].Description)
+	}
+}
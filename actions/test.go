@@ -20,6 +20,16 @@
 package burrow
 
 import (
+	gocontext "context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/EmbeddedEnterprises/burrow/utils"
 	"github.com/mattn/go-shellwords"
 	"github.com/urfave/cli"
@@ -28,18 +38,28 @@ import (
 // Test runs all existing tests of the burrow project.
 func Test(context *cli.Context, useSecondLevelArgs bool) error {
 	burrow.LoadConfig()
-
-	outputs := []string{}
-
-	if burrow.IsTargetUpToDate("test", outputs) && !context.Bool("force") {
-		burrow.Log(burrow.LOG_INFO, "test", "Tests are up-to-date")
-		return nil
+	if err := runPrerequisites(context, "test"); err != nil {
+		return err
 	}
+	return test(context, useSecondLevelArgs)
+}
 
-	burrow.Log(burrow.LOG_INFO, "test", "Running tests for project")
+// test runs the tests without running its prerequisites. Every package is cached on its own: only
+// the tests of packages whose files or (local) dependencies changed are run, unless --all is given.
+func test(context *cli.Context, useSecondLevelArgs bool) error {
+	reports, err := getTestReports(context)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "test", "Invalid --report: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
 
 	args := []string{}
-	args = append(args, "test")
+	args = append(args, "-json")
+	cover := context.Bool("cover")
+	if cover {
+		args = append(args, burrow.CoverageArgs()...)
+		args = append(args, "-coverprofile="+coverageTestProfile)
+	}
 	userArgs, err := shellwords.Parse(burrow.Config.Args.Go.Test)
 	if err != nil {
 		burrow.Log(burrow.LOG_ERR, "test", "Failed to read user arguments from config file: %s", err)
@@ -51,12 +71,302 @@ func Test(context *cli.Context, useSecondLevelArgs bool) error {
 		args = append(args, burrow.GetSecondLevelArgs()...)
 	}
 
-	err = burrow.Exec("test", "go", args...)
-	if err == nil {
-		burrow.UpdateTarget("test", outputs)
+	flags, patterns := burrow.SplitTestArgs(args)
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	inputs, err := burrow.GetTestInputs(patterns...)
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "test", "Failed to list the packages to test: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	all := context.Bool("all") || context.Bool("force")
+	var coverTarget burrow.Target
+	if cover {
+		// the coverage profile is only complete if all packages are tested in the same run
+		coverTarget = burrow.Target{
+			Name:    "test",
+			Args:    append(append([]string{}, args...), "coverage"),
+			Inputs:  burrow.GetPackageInputs("test", nil, true, patterns...),
+			Outputs: []string{coverageTestProfile},
+		}
+		all = all || !burrow.IsTargetUpToDate(coverTarget)
+	}
+
+	targets := map[string]burrow.Target{}
+	stale := []string{}
+	report := burrow.TestReport{Packages: []burrow.PackageResult{}}
+	for _, pkg := range sortedPackages(inputs) {
+		target := burrow.Target{
+			Name:    "test",
+			Args:    append(append([]string{}, flags...), "package="+pkg),
+			Inputs:  inputs[pkg],
+			Outputs: []string{burrow.TestResultFile(pkg)},
+		}
+		targets[pkg] = target
+
+		if !all && burrow.IsTargetUpToDate(target) {
+			if result, err := burrow.ReadTestResult(pkg); err == nil {
+				result.Cached = true
+				report.Add(result)
+				burrow.Log(burrow.LOG_INFO, "test", "ok  \t%s\t(cached)", pkg)
+				continue
+			}
+		}
+		stale = append(stale, pkg)
+	}
+
+	if len(inputs) == 0 {
+		burrow.Log(burrow.LOG_INFO, "test", "There are no test packages")
+	} else if len(stale) == 0 {
+		burrow.Log(burrow.LOG_INFO, "test", "Tests are up-to-date")
+	} else {
+		if len(stale) == 1 {
+			burrow.Log(burrow.LOG_INFO, "test", "Running tests of %s", stale[0])
+		} else {
+			burrow.Log(burrow.LOG_INFO, "test", "Running tests of %d packages", len(stale))
+		}
+		if cover {
+			if err := os.MkdirAll(filepath.Dir(coverageTestProfile), 0755); err != nil {
+				burrow.Log(burrow.LOG_ERR, "test", "Failed to create the coverage directory: %s", err)
+				return cli.NewExitError("", burrow.EXIT_ACTION)
+			}
+		}
+
+		run := stale
+		if cover {
+			// packages without tests are part of the coverage as well
+			run = patterns
+		}
+		testArgs := append(append([]string{"test"}, flags...), run...)
+		recorder := burrow.NewTestRecorder("test", isVerbose(flags))
+		err = burrow.ExecWriter(gocontext.Background(), "test", "", nil, recorder, "go", testArgs...)
+		results := recorder.Report().Packages
+		retries := context.Int("retries")
+		if retries < 1 {
+			retries = burrow.Config.Test.Retries
+		}
+		if err != nil && retries > 0 {
+			results, err = retryTests(flags, results, retries)
+		}
+		for _, result := range results {
+			report.Add(result)
+			target, ok := targets[result.Name]
+			if !ok || result.Status != "pass" {
+				continue
+			}
+			if err := burrow.WriteTestResult(result); err != nil {
+				burrow.Log(burrow.LOG_WARN, "test", "Failed to store the test result of %s: %s", result.Name, err)
+				continue
+			}
+			burrow.UpdateTarget(target)
+		}
+		if err == nil && cover {
+			burrow.UpdateTarget(coverTarget)
+		}
+
+		burrow.Deprecation("test", append([]string{"go"}, testArgs...))
 	}
 
-	burrow.Deprecation("test", append([]string{"go"}, args...))
+	logTestSummary(report)
+	if reportErr := writeTestReports(report, reports); reportErr != nil && err == nil {
+		err = reportErr
+	}
+	if err == nil && cover {
+		err = writeCoverage()
+	}
 
 	return err
 }
+
+// retryTests runs the failed tests of every package again until they pass or they were retried the
+// given number of times. The flaky tests are recorded in the flaky test history of the project. An
+// error is returned if a package still fails.
+func retryTests(flags []string, results []burrow.PackageResult, retries int) ([]burrow.PackageResult, error) {
+	retryFlags := []string{}
+	for _, flag := range flags {
+		// the coverage profile of the first run must not be replaced by the profile of a retry
+		if !strings.HasPrefix(flag, "-coverprofile") {
+			retryFlags = append(retryFlags, flag)
+		}
+	}
+
+	for attempt := 1; attempt <= retries; attempt++ {
+		for i := range results {
+			tests := results[i].FailedTests()
+			if results[i].Status != "fail" || len(tests) == 0 {
+				continue
+			}
+			for j := range tests {
+				tests[j] = regexp.QuoteMeta(tests[j])
+			}
+
+			burrow.Log(
+				burrow.LOG_WARN, "test", "Retrying %d failed tests of %s (attempt %d of %d)",
+				len(tests), results[i].Name, attempt, retries,
+			)
+			args := append([]string{"test"}, retryFlags...)
+			// a retry must run the tests again instead of reporting a cached result
+			args = append(args, "-count=1", "-run", "^("+strings.Join(tests, "|")+")$", results[i].Name)
+			recorder := burrow.NewTestRecorder("test", isVerbose(flags))
+			_ = burrow.ExecWriter(gocontext.Background(), "test", "", nil, recorder, "go", args...)
+			for _, retry := range recorder.Report().Packages {
+				if retry.Name == results[i].Name {
+					results[i].Retry(retry, attempt)
+				}
+			}
+		}
+	}
+
+	history, err := burrow.ReadFlakyHistory()
+	if err != nil {
+		burrow.Log(burrow.LOG_WARN, "test", "Replacing unreadable flaky test history: %s", err)
+	}
+	failed := false
+	now := time.Now()
+	for _, result := range results {
+		history.Record(result, now)
+		for _, test := range result.Tests {
+			if test.Flaky {
+				burrow.Log(burrow.LOG_WARN, "test", "%s %s is flaky, it passed after %d retries", result.Name, test.Name, test.Retries)
+			}
+		}
+		failed = failed || result.Status == "fail"
+	}
+	if err := history.Write(); err != nil {
+		burrow.Log(burrow.LOG_WARN, "test", "Failed to store the flaky test history: %s", err)
+	}
+
+	if failed {
+		return results, cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	return results, nil
+}
+
+// TestFlaky lists the tests of the flaky test history of the project, the tests that flaked most
+// often first.
+func TestFlaky(context *cli.Context) error {
+	burrow.LoadConfig()
+
+	history, err := burrow.ReadFlakyHistory()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "test", "Failed to read the flaky test history: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	if len(history.Tests) == 0 {
+		burrow.Log(burrow.LOG_INFO, "test", "No flaky tests have been recorded")
+		return nil
+	}
+
+	top := context.Int("top")
+	rows := [][]string{{"PACKAGE", "TEST", "FLAKES", "FAILURES", "LAST FLAKE"}}
+	for i, test := range history.Sorted() {
+		if top > 0 && i == top {
+			break
+		}
+		last := "never"
+		if !test.LastFlake.IsZero() {
+			last = test.LastFlake.Local().Format("2006-01-02 15:04")
+		}
+		rows = append(rows, []string{test.Package, test.Test, strconv.Itoa(test.Flakes), strconv.Itoa(test.Failures), last})
+	}
+	logTable("test", rows)
+	return nil
+}
+
+// sortedPackages returns the packages of a map of files by package in ascending order.
+func sortedPackages(files map[string][]string) []string {
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getTestReports reads the report files from the --report flag, e.g. junit=out.xml,json=out.json,
+// and returns them by format.
+func getTestReports(context *cli.Context) (map[string]string, error) {
+	reports := map[string]string{}
+	for _, value := range context.StringSlice("report") {
+		for _, report := range strings.Split(value, ",") {
+			if report = strings.TrimSpace(report); report == "" {
+				continue
+			}
+			parts := strings.SplitN(report, "=", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				return nil, fmt.Errorf("expected <format>=<file> instead of '%s'", report)
+			}
+			if parts[0] != "junit" && parts[0] != "json" {
+				return nil, fmt.Errorf("unknown report format '%s', use junit or json", parts[0])
+			}
+			reports[parts[0]] = parts[1]
+		}
+	}
+	return reports, nil
+}
+
+// writeTestReports writes the test report in all requested formats.
+func writeTestReports(report burrow.TestReport, reports map[string]string) error {
+	for format, file := range reports {
+		var err error
+		switch format {
+		case "junit":
+			err = report.WriteJUnit(file)
+		case "json":
+			err = report.WriteJSON(file)
+		}
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "test", "Failed to write the %s report %s: %s", format, file, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+		burrow.Log(burrow.LOG_INFO, "test", "Wrote %s report to %s", format, file)
+	}
+	return nil
+}
+
+// isVerbose checks whether 'go test' is run with -v, in which case the output of all tests is
+// logged.
+func isVerbose(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "-v", "-v=true", "-test.v", "-test.v=true", "--v":
+			return true
+		}
+	}
+	return false
+}
+
+// logTestSummary logs a table with the number of passed, failed and skipped tests of every package
+// that has tests or failed.
+func logTestSummary(report burrow.TestReport) {
+	rows := [][]string{{"STATUS", "PACKAGE", "PASS", "FAIL", "SKIP", "TIME"}}
+	for _, pkg := range report.Packages {
+		if len(pkg.Tests) == 0 && pkg.Status != "fail" {
+			continue
+		}
+		status := "ok"
+		switch {
+		case pkg.Cached:
+			status = "cached"
+		case pkg.Status == "fail":
+			status = "FAIL"
+		case pkg.Status == "skip":
+			status = "skip"
+		}
+		rows = append(rows, []string{
+			status, pkg.Name,
+			strconv.Itoa(pkg.Passed), strconv.Itoa(pkg.Failed), strconv.Itoa(pkg.Skipped),
+			fmt.Sprintf("%.2fs", pkg.Elapsed),
+		})
+	}
+	if len(rows) == 1 {
+		return
+	}
+	logTable("test", rows)
+	burrow.Log(
+		burrow.LOG_INFO, "test", "%d passed (%d flaky), %d failed, %d skipped in %.2fs",
+		report.Passed, report.Flaky, report.Failed, report.Skipped, report.Elapsed,
+	)
+}
@@ -0,0 +1,221 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/EmbeddedEnterprises/burrow/utils"
+	"github.com/urfave/cli"
+)
+
+// The verification struct describes the layout of the reproducible.json written by VerifyBuild.
+type verification struct {
+	Reproducible    bool               `json:"reproducible"`
+	SourceDateEpoch string             `json:"sourceDateEpoch"`
+	Command         []string           `json:"command"`
+	Files           []verificationFile `json:"files"`
+	Manifest        verificationFile   `json:"manifest"`
+}
+
+// The verificationFile struct describes the digests of a binary in both builds of VerifyBuild. A
+// missing digest means that the binary was not created by the build.
+type verificationFile struct {
+	Path         string `json:"path"`
+	First        string `json:"sha256First"`
+	Second       string `json:"sha256Second"`
+	Reproducible bool   `json:"reproducible"`
+}
+
+// VerifyBuild builds the application twice with --reproducible in two temporary copies of the
+// project and compares the SHA-256 digests of all binaries listed in the manifest.json of the
+// builds and of the manifest.json itself. The result is written to the reproducible.json next to
+// the binaries.
+func VerifyBuild(context *cli.Context) error {
+	burrow.LoadConfig()
+
+	profile, err := burrow.GetProfile(context.String("profile"))
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "verify-build", "Failed to read profile: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	project, err := burrow.GetProject()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "verify-build", "Failed to find the project: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "verify-build", "Failed to find the burrow executable: %s", err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	epoch := burrow.GetSourceDateEpoch()
+
+	args := []string{"build", "--reproducible", "--force"}
+	if profile.Name != "" {
+		args = append(args, "--profile", profile.Name)
+	}
+	for _, platform := range context.StringSlice("platform") {
+		args = append(args, "--platform", platform)
+	}
+	if jobs := context.Int("jobs"); jobs > 0 {
+		args = append(args, "--jobs", strconv.Itoa(jobs))
+	}
+
+	outputDir := path.Clean(profile.OutputDir())
+	if filepath.IsAbs(outputDir) {
+		burrow.Log(burrow.LOG_ERR, "verify-build", "The output directory of the profile has to be inside of the project")
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	hashes := [2]map[string]string{}
+	manifests := [2]string{}
+	for i := range hashes {
+		burrow.Log(burrow.LOG_INFO, "verify-build", "Building copy %d of the project", i+1)
+		hashes[i], manifests[i], err = buildCopy(project, executable, outputDir, epoch, args)
+		if err != nil {
+			burrow.Log(burrow.LOG_ERR, "verify-build", "Failed to build copy %d of the project: %s", i+1, err)
+			return cli.NewExitError("", burrow.EXIT_ACTION)
+		}
+	}
+
+	result := verification{
+		Reproducible:    len(hashes[0]) > 0,
+		SourceDateEpoch: epoch,
+		Command:         append([]string{"burrow"}, args...),
+		Files:           []verificationFile{},
+		Manifest: verificationFile{
+			Path:         path.Join(outputDir, "manifest.json"),
+			First:        manifests[0],
+			Second:       manifests[1],
+			Reproducible: manifests[0] == manifests[1],
+		},
+	}
+	paths := []string{}
+	for file := range hashes[0] {
+		paths = append(paths, file)
+	}
+	for file := range hashes[1] {
+		if _, ok := hashes[0][file]; !ok {
+			paths = append(paths, file)
+		}
+	}
+	sort.Strings(paths)
+	for _, file := range paths {
+		entry := verificationFile{
+			Path:   file,
+			First:  hashes[0][file],
+			Second: hashes[1][file],
+		}
+		entry.Reproducible = entry.First != "" && entry.First == entry.Second
+		if !entry.Reproducible {
+			result.Reproducible = false
+			burrow.Log(burrow.LOG_ERR, "verify-build", "%s is not reproducible", entry.Path)
+		}
+		result.Files = append(result.Files, entry)
+	}
+	if !result.Manifest.Reproducible {
+		result.Reproducible = false
+		burrow.Log(burrow.LOG_ERR, "verify-build", "%s is not reproducible", result.Manifest.Path)
+	}
+
+	manifest := filepath.Join(outputDir, "reproducible.json")
+	err = burrow.WriteFileAtomic(manifest, 0644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	})
+	if err != nil {
+		burrow.Log(burrow.LOG_ERR, "verify-build", "Failed to write %s: %s", manifest, err)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+
+	if !result.Reproducible {
+		burrow.Log(burrow.LOG_ERR, "verify-build", "The build is not reproducible, see %s", manifest)
+		return cli.NewExitError("", burrow.EXIT_ACTION)
+	}
+	burrow.Log(burrow.LOG_INFO, "verify-build", "All %d binaries are reproducible", len(result.Files))
+	return nil
+}
+
+// buildCopy copies the project without its build artifacts to a temporary directory, builds it
+// there with burrow and returns the digests of the binaries in the manifest.json of the build by
+// their path and the digest of the manifest.json. The digests recorded in the manifest have to
+// match the built binaries. The temporary directory and its cache directory are removed afterwards.
+func buildCopy(project burrow.Project, executable string, outputDir string, epoch string, args []string) (map[string]string, string, error) {
+	dir, err := ioutil.TempDir("", "burrow-verify-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return nil, "", err
+	}
+
+	skip := func(file string) bool {
+		return file == outputDir || file == "bin" || file == "package"
+	}
+	if err := burrow.CopyTree(project.Root, dir, skip); err != nil {
+		return nil, "", err
+	}
+
+	copied := burrow.Project{Root: dir, Module: project.Module, Name: project.Name}
+	if cacheRoot, err := burrow.GetCacheRoot(); err == nil {
+		defer os.RemoveAll(filepath.Join(cacheRoot, copied.Hash()))
+	}
+
+	env := []string{"SOURCE_DATE_EPOCH=" + epoch}
+	if err := burrow.ExecEnv("verify-build", dir, env, executable, args...); err != nil {
+		return nil, "", fmt.Errorf("burrow build failed")
+	}
+
+	file := filepath.Join(dir, outputDir, "manifest.json")
+	manifestHash, err := burrow.HashFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	manifest, err := burrow.ReadManifest(file)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(manifest.Artifacts) == 0 {
+		return nil, "", fmt.Errorf("the build did not record any binaries in %s", path.Join(outputDir, "manifest.json"))
+	}
+	hashes := map[string]string{}
+	for _, artifact := range manifest.Artifacts {
+		hash, err := burrow.HashFile(filepath.Join(dir, filepath.FromSlash(artifact.Path)))
+		if err != nil {
+			return nil, "", err
+		}
+		if hash != artifact.SHA256 {
+			return nil, "", fmt.Errorf("the digest of %s does not match the manifest", artifact.Path)
+		}
+		hashes[artifact.Path] = hash
+	}
+	return hashes, manifestHash, nil
+}
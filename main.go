@@ -34,6 +34,22 @@ func main() {
 		Name:  "force, f",
 		Usage: "Forces this action to be run, even if cached data is available",
 	}
+	platformFlag := cli.StringSliceFlag{
+		Name:  "platform, p",
+		Usage: "Build for a platform (goos/goarch[/variant]) instead of the platforms of the burrow.yaml",
+	}
+	jobsFlag := cli.IntFlag{
+		Name:  "jobs, j",
+		Usage: "Build at most N binaries at the same time (default: number of CPUs)",
+	}
+	profileFlag := cli.StringFlag{
+		Name:  "profile",
+		Usage: "Build with a profile of the burrow.yaml or one of the built-in profiles debug, release and race",
+	}
+	reproducibleFlag := cli.BoolFlag{
+		Name:  "reproducible",
+		Usage: "Build reproducible binaries with -trimpath, -buildvcs=false, a fixed SOURCE_DATE_EPOCH and a cleared environment",
+	}
 	exampleFlag := cli.StringFlag{
 		Name:  "example, e",
 		Usage: "Run an example (specified by name) instead of the application itself",
@@ -67,6 +83,20 @@ Aliases:
    {{join .Aliases ", "}}
    {{end}}
 burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
+`
+	cli.SubcommandHelpTemplate = `Usage: {{.HelpName}} command{{if .VisibleFlags}} [command options]{{end}} {{if .ArgsUsage}}{{.ArgsUsage}}{{else}}[arguments...]{{end}}
+
+{{.Usage}}{{if .Description}}
+
+Description:
+   {{.Description}}
+   {{end}}
+Commands:
+{{range .Commands}}{{if not .HideHelp}}   {{join .Names ", "}}{{ "\t"}}{{.Usage}}{{ "\n" }}{{end}}{{end}}{{if .VisibleFlags}}
+Options:
+   {{range .VisibleFlags}}{{.}}
+   {{end}}{{end}}
+burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
 `
 
 	app := cli.NewApp()
@@ -133,36 +163,206 @@ burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
 			Action:      utils.WrapAction(actions.Update),
 		},
 		{
-			Name:        "run",
-			Aliases:     []string{"r"},
-			Flags:       []cli.Flag{exampleFlag},
+			Name:    "run",
+			Aliases: []string{"r"},
+			Flags: []cli.Flag{
+				exampleFlag,
+				profileFlag,
+				cli.BoolFlag{
+					Name:  "cover",
+					Usage: "Build the application with coverage instrumentation and collect its coverage in coverage/",
+				},
+			},
 			Usage:       "Run the application.",
-			Description: "This runs the main package with 'go run'. Any arguments following -- will be directly passed to your application.",
+			Description: "This runs the main package with 'go run'. Any arguments following -- will be directly passed to your application. With --cover the coverage of the run is merged into the reports of 'burrow test --cover'.",
 			Action:      utils.WrapAction(actions.Run),
 		},
 		{
-			Name:        "test",
-			Aliases:     []string{"t"},
-			Flags:       []cli.Flag{forceFlag},
+			Name:    "test",
+			Aliases: []string{"t"},
+			Flags: []cli.Flag{
+				forceFlag,
+				cli.StringSliceFlag{
+					Name:  "report",
+					Usage: "Write test reports, e.g. junit=report.xml,json=report.json",
+				},
+				cli.BoolFlag{
+					Name:  "cover",
+					Usage: "Collect coverage and write text, HTML and Cobertura reports to coverage/",
+				},
+				cli.BoolFlag{
+					Name:  "all, a",
+					Usage: "Run the tests of all packages instead of only the packages affected by changes",
+				},
+				cli.IntFlag{
+					Name:  "retries",
+					Usage: "Retry failed tests up to N times and report the tests that pass on a retry as flaky",
+				},
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:    "flaky",
+					Aliases: []string{},
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "top, n",
+							Value: 10,
+							Usage: "Show the N tests that flaked most often",
+						},
+					},
+					Usage:       "List the tests that flaked most often.",
+					Description: "This lists the tests of the flaky test history in .burrow/flaky.json, which records the tests that passed only after a retry of 'burrow test --retries'.",
+					Action:      actions.TestFlaky,
+				},
+			},
 			Usage:       "Run all existing tests of the application.",
-			Description: "This runs 'go test' in the current directory. Any arguments following -- will be directly passed to 'go test'.",
-			Action:      utils.WrapAction(actions.Test),
+			Description: "This runs 'go test' for all packages of the project (./...). Any arguments following -- will be directly passed to 'go test', package patterns among them replace ./....",
+			Action:      locked(utils.WrapAction(actions.Test)),
+		},
+		{
+			Name:    "bench",
+			Aliases: []string{},
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "bench",
+					Usage: "Run the benchmarks matching this regular expression instead of all benchmarks",
+				},
+				cli.IntFlag{
+					Name:  "count",
+					Usage: "Run each benchmark N times (default: bench.count of the burrow.yaml or 10)",
+				},
+				cli.StringFlag{
+					Name:  "benchtime",
+					Usage: "Run each benchmark for this duration or number of iterations (e.g. 1s, 100x)",
+				},
+				cli.StringFlag{
+					Name:  "baseline",
+					Usage: "Compare against the stored results of this name, version or commit instead of the latest results",
+				},
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:        "list",
+					Aliases:     []string{"ls"},
+					Flags:       []cli.Flag{},
+					Usage:       "List the stored benchmark results.",
+					Description: "This lists the benchmark results stored in .burrow/bench, which can be used as --baseline of 'burrow bench'.",
+					Action:      actions.BenchList,
+				},
+			},
+			Usage:       "Run the benchmarks and compare them against a baseline.",
+			Description: "This runs 'go test -bench' for all packages and stores the results of the current version and commit in .burrow/bench. The results are compared against the latest stored results or the --baseline and the action fails when a benchmark regressed by more than bench.maxregression. Any arguments following -- will be directly passed to 'go test'.",
+			Action:      locked(utils.WrapAction(actions.Bench)),
 		},
 		{
 			Name:        "build",
 			Aliases:     []string{"b"},
-			Flags:       []cli.Flag{forceFlag},
+			Flags:       []cli.Flag{forceFlag, platformFlag, jobsFlag, profileFlag, reproducibleFlag},
 			Usage:       "Build the application.",
-			Description: "This runs 'go build' in the current directory for your application and all examples. Any arguments following -- will be directly passed to 'go build'.",
-			Action:      utils.WrapAction(actions.Build),
+			Description: "This runs 'go build' in the current directory for your application and all examples. The binaries of every platform given with --platform or in the build.platforms list of the burrow.yaml are built to bin/<goos>_<goarch>/. Any arguments following -- will be directly passed to 'go build'.",
+			Action:      locked(utils.WrapAction(actions.Build)),
+		},
+		{
+			Name:        "verify-build",
+			Aliases:     []string{},
+			Flags:       []cli.Flag{platformFlag, jobsFlag, profileFlag},
+			Usage:       "Verify that the build of the application is reproducible.",
+			Description: "This builds the application twice with --reproducible in two temporary copies of the project and compares the SHA-256 digests of all binaries. The result is written to reproducible.json next to the binaries.",
+			Action:      locked(actions.VerifyBuild),
+		},
+		{
+			Name:    "size",
+			Aliases: []string{},
+			Flags: []cli.Flag{
+				platformFlag,
+				profileFlag,
+				cli.IntFlag{
+					Name:  "top, n",
+					Value: 10,
+					Usage: "Show the N largest packages and symbols",
+				},
+				cli.BoolFlag{
+					Name:  "update-baseline",
+					Usage: "Store the sizes as the baseline of the following runs",
+				},
+			},
+			Usage:       "Show the size contributions of the packages and symbols of the binaries.",
+			Description: "This builds the application and reads the symbol tables of the binaries with 'go tool nm -size'. The sizes are compared against the baseline stored in .burrow/size, and the command fails if a binary grew more than the size.maxgrowth of the burrow.yaml.",
+			Action:      locked(actions.Size),
+		},
+		{
+			Name:        "pgo",
+			Aliases:     []string{},
+			Flags:       []cli.Flag{},
+			Usage:       "Manage the profiles for profile-guided optimization.",
+			Description: "This manages the default.pgo CPU profiles of the main packages, which 'go build' uses for profile-guided optimization.",
+			Subcommands: []cli.Command{
+				{
+					Name:    "collect",
+					Aliases: []string{},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "bench",
+							Usage: "Profile the benchmarks matching this regular expression",
+						},
+						cli.StringSliceFlag{
+							Name:  "package",
+							Usage: "Run the benchmarks of this package instead of the main package (can be repeated)",
+						},
+						cli.StringFlag{
+							Name:  "benchtime",
+							Value: "1s",
+							Usage: "Run each benchmark for this duration or number of iterations (e.g. 10s, 100x)",
+						},
+						cli.StringFlag{
+							Name:  "url",
+							Usage: "Run the application and download a CPU profile from this net/http/pprof url",
+						},
+						cli.IntFlag{
+							Name:  "seconds",
+							Value: 30,
+							Usage: "Profile the application for this number of seconds",
+						},
+						cli.StringFlag{
+							Name:  "binary",
+							Usage: "Collect the profile for this binary instead of the main binary",
+						},
+						cli.BoolFlag{
+							Name:  "append",
+							Usage: "Merge the existing default.pgo into the new profile",
+						},
+					},
+					Usage:       "Collect CPU profiles and merge them into the default.pgo of a main package.",
+					Description: "This runs the benchmarks matching --bench or the application itself with CPU profiling enabled and merges the profiles into the default.pgo of the main package. Any arguments following -- are passed to the application. Builds with the release profile pass the default.pgo to 'go build' with -pgo.",
+					Action:      locked(utils.WrapAction(actions.PgoCollect)),
+				},
+			},
+		},
+		{
+			Name:        "task",
+			Aliases:     []string{},
+			Flags:       []cli.Flag{forceFlag},
+			Usage:       "Run a task defined in the burrow.yaml.",
+			Description: "This runs the commands of a task from the 'tasks' section of the burrow.yaml. Without a task name all tasks are listed. Any arguments following -- are passed to the commands of the task as positional parameters.",
+			ArgsUsage:   "[name]",
+			Action:      locked(utils.WrapAction(actions.Task)),
+		},
+		{
+			Name:        "graph",
+			Aliases:     []string{},
+			Flags:       []cli.Flag{},
+			Usage:       "Show the actions and tasks that run for a target.",
+			Description: "This prints the dependency graph of an action or task (default: package) grouped into stages. All entries of a stage may run in parallel.",
+			ArgsUsage:   "[target]",
+			Action:      actions.Graph,
 		},
 		{
 			Name:        "install",
 			Aliases:     []string{"i", "in", "inst"},
-			Flags:       []cli.Flag{forceFlag},
+			Flags:       []cli.Flag{forceFlag, profileFlag},
 			Usage:       "Install the application in the GOPATH.",
 			Description: "This runs 'go install' in the current directory.",
-			Action:      actions.Install,
+			Action:      locked(actions.Install),
 		},
 		{
 			Name:        "uninstall",
@@ -175,10 +375,10 @@ burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
 		{
 			Name:        "package",
 			Aliases:     []string{"pack"},
-			Flags:       []cli.Flag{forceFlag},
+			Flags:       []cli.Flag{forceFlag, platformFlag, jobsFlag, profileFlag},
 			Usage:       "Create a .tar.gz containing the binary.",
 			Description: "This runs 'tar' to package your application.",
-			Action:      actions.Package,
+			Action:      locked(actions.Package),
 		},
 		{
 			Name:        "publish",
@@ -186,15 +386,20 @@ burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
 			Flags:       []cli.Flag{},
 			Usage:       "Publish the current version by building a package and setting a version tag in git.",
 			Description: "This runs 'git tag -f vX.Y.Z' in the current directory. Any arguments following -- will be directly passed to git.",
-			Action:      utils.WrapAction(actions.Publish),
+			Action:      locked(utils.WrapAction(actions.Publish)),
 		},
 		{
-			Name:        "clean",
-			Aliases:     []string{},
-			Flags:       []cli.Flag{},
+			Name:    "clean",
+			Aliases: []string{},
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "cache, c",
+					Usage: "Also remove the target cache of this project",
+				},
+			},
 			Usage:       "Clean the project from any build artifacts.",
 			Description: "This runs 'go clean' in the current directory and removes artifacts created by burrow.",
-			Action:      actions.Clean,
+			Action:      locked(actions.Clean),
 		},
 		{
 			Name:        "doc",
@@ -210,7 +415,15 @@ burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
 			Flags:       []cli.Flag{forceFlag},
 			Usage:       "Format the code of this project with 'go fmt'.",
 			Description: "This runs 'go fmt' in the current directory. Any arguments following -- will be directly passed to 'go fmt'.",
-			Action:      utils.WrapAction(actions.Format),
+			Action:      locked(utils.WrapAction(actions.Format)),
+		},
+		{
+			Name:        "generate",
+			Aliases:     []string{"gen"},
+			Flags:       []cli.Flag{forceFlag},
+			Usage:       "Run the go:generate directives of all packages.",
+			Description: "This runs 'go generate' for every package with //go:generate directives whose files or generators changed. Any arguments following -- will be directly passed to 'go generate'.",
+			Action:      locked(utils.WrapAction(actions.Generate)),
 		},
 		{
 			Name:        "check",
@@ -218,7 +431,7 @@ burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
 			Flags:       []cli.Flag{forceFlag},
 			Usage:       "Check the code with 'go vet'.",
 			Description: "This runs 'go vet' in the current directory. Any arguments following -- will be directly passed to 'go vet'.",
-			Action:      utils.WrapAction(actions.Check),
+			Action:      locked(utils.WrapAction(actions.Check)),
 		},
 		{
 			Name:        "major",
@@ -244,6 +457,73 @@ burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
 			Description: "This increments the version number stored in the burrow.yaml file by the patch part of the semantic version string.",
 			Action:      actions.Patch,
 		},
+		{
+			Name:        "cache",
+			Aliases:     []string{},
+			Flags:       []cli.Flag{},
+			Usage:       "Inspect and manage the target cache of this project.",
+			Description: "This manages the cached state of all targets of this project which is stored in ~/.cache/burrow.",
+			Subcommands: []cli.Command{
+				{
+					Name:        "info",
+					Aliases:     []string{},
+					Flags:       []cli.Flag{},
+					Usage:       "Print which cache directory this project maps to.",
+					Description: "This prints the project root, the module path and the cache directory of this project.",
+					Action:      actions.CacheInfo,
+				},
+				{
+					Name:        "ls",
+					Aliases:     []string{"list"},
+					Flags:       []cli.Flag{},
+					Usage:       "List all cached targets of this project.",
+					Description: "This lists every cached target of this project with its age, size and the reason it would be rebuilt.",
+					Action:      actions.CacheList,
+				},
+				{
+					Name:        "clear",
+					Aliases:     []string{},
+					Flags:       []cli.Flag{},
+					Usage:       "Remove the cache entries of a target or of the whole project.",
+					Description: "This removes all cache entries of the target given as argument. Without argument the whole cache of this project is removed.",
+					ArgsUsage:   "[target]",
+					Action:      locked(actions.CacheClear),
+				},
+				{
+					Name:    "prune",
+					Aliases: []string{},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "older-than",
+							Value: "30d",
+							Usage: "Remove cache entries that have not been used for this duration (e.g. 30d, 12h)",
+						},
+					},
+					Usage:       "Garbage-collect the caches of all projects on this machine.",
+					Description: "This removes the caches of deleted projects, all cache entries that have not been used for a given duration and the stored outputs no remaining entry references. Every cache is pruned while holding the lock of its project.",
+					Action:      actions.CachePrune,
+				},
+				{
+					Name:    "serve",
+					Aliases: []string{},
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "listen, l",
+							Value: ":8080",
+							Usage: "The address the cache server listens on",
+						},
+						cli.StringFlag{
+							Name:  "dir, d",
+							Value: "./burrow-cache",
+							Usage: "The directory the cache data is stored in",
+						},
+					},
+					Usage:       "Run a shared remote cache server.",
+					Description: "This runs a simple http server storing cache entries and artifacts in a local directory. Configure 'cache.remote' in the burrow.yaml to share build results through this server.",
+					Action:      actions.CacheServe,
+				},
+			},
+		},
 		{
 			Name:        "migrate",
 			Aliases:     []string{},
@@ -254,7 +534,27 @@ burrow - Copyright (c) 2017-2019  EmbeddedEnterprises
 		},
 	}
 
+	cli.OsExiter = func(code int) {
+		utils.UnlockProject()
+		os.Exit(code)
+	}
+
 	app.Run(os.Args)
+	utils.UnlockProject()
 
 	utils.LogDeprecationMessage()
 }
+
+// locked wraps an action that uses the target cache, so it runs while holding the lock of the
+// project. The lock is released when the action returns.
+func locked(action func(*cli.Context) error) func(*cli.Context) error {
+	return func(context *cli.Context) error {
+		utils.LoadConfig()
+		if err := utils.LockProject(); err != nil {
+			utils.Log(utils.LOG_ERR, "burrow", "Failed to lock project: %s", err)
+			return cli.NewExitError("", utils.EXIT_LOCK)
+		}
+		defer utils.UnlockProject()
+		return action(context)
+	}
+}
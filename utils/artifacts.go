@@ -0,0 +1,164 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ActionKey returns the content address of a target. In contrast to the CacheKey, which identifies
+// the latest state of a target of a project on this machine, the action key is derived from the
+// module path and the content of all inputs. It is the same for every checkout building the same
+// sources, so outputs stored for an action key can be restored on every machine and after switching
+// branches.
+func (target Target) ActionKey(inputs map[string]FileState) string {
+	project, _ := GetProject()
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "module %q\n", project.Module)
+	fmt.Fprintf(hasher, "cache %q\n", target.CacheKey())
+	for _, path := range sortedKeys(inputs) {
+		fmt.Fprintf(hasher, "input %q %s\n", filepath.ToSlash(path), inputs[path].Hash)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// restoreTarget looks up the action key of a target in a cache backend. If the target already ran
+// with the same inputs, the outputs of the target are restored from the backend and the local cache
+// entry of the target is updated. The source parameter names the backend in log messages.
+func restoreTarget(target Target, backend CacheBackend, source string) bool {
+	if backend == nil {
+		return false
+	}
+
+	inputs, err := GetFileStates(target.Inputs)
+	if err != nil {
+		return false
+	}
+
+	cache, err := fetchTargetCache(backend, "ac/"+target.ActionKey(inputs))
+	if err == ErrCacheMiss {
+		return false
+	}
+	if err == nil {
+		err = cache.validate(target.Name)
+	}
+	if err != nil {
+		Log(LOG_WARN, target.Name, "Failed to query %s: %s", source, err)
+		return false
+	}
+	if describeChanges("input", target.Inputs, cache.Inputs) != "" {
+		return false
+	}
+
+	restored := 0
+	for _, output := range target.Outputs {
+		state, ok := cache.Outputs[output]
+		if !ok {
+			return false
+		}
+		if current, err := GetFileState(output, FileState{}); err == nil && current.Hash == state.Hash {
+			continue
+		}
+		if err := restoreFile(backend, output, state); err != nil {
+			Log(LOG_WARN, target.Name, "Failed to restore %s from %s: %s", output, source, err)
+			return false
+		}
+		restored++
+	}
+
+	cache.Inputs = inputs
+	if cache.Outputs, err = GetFileStates(target.Outputs); err != nil {
+		return false
+	}
+	if err := writeTargetCache(target, cache); err != nil {
+		Log(LOG_WARN, target.Name, "Failed to update target cache: %s", err)
+	}
+
+	if restored > 0 {
+		Log(LOG_INFO, target.Name, "Restored %d outputs from %s", restored, source)
+	}
+	return true
+}
+
+// restoreFile copies the artifact with the given state from a cache backend to file. The content of
+// the artifact is verified before it replaces the file.
+func restoreFile(backend CacheBackend, file string, state FileState) error {
+	reader, err := backend.Get("cas/" + state.Hash)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	mode := os.FileMode(state.Mode)
+	if mode == 0 {
+		mode = 0644
+	}
+
+	return WriteFileAtomic(file, mode, func(w io.Writer) error {
+		hasher := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, hasher), reader); err != nil {
+			return err
+		}
+		if hash := hex.EncodeToString(hasher.Sum(nil)); hash != state.Hash {
+			return fmt.Errorf("digest mismatch, expected %s but got %s", state.Hash, hash)
+		}
+		return nil
+	})
+}
+
+// storeTarget stores the outputs and the cache entry of a target under its action key in a cache
+// backend. The outputs are stored first, so a cache entry is never visible with missing artifacts.
+// Outputs that are already stored in the backend are skipped.
+func storeTarget(target Target, cache TargetCache, backend CacheBackend) error {
+	for _, output := range sortedKeys(cache.Outputs) {
+		key := "cas/" + cache.Outputs[output].Hash
+		if exists, err := backend.Exists(key); err != nil || exists {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		file, err := os.Open(output)
+		if err != nil {
+			return err
+		}
+		err = backend.Put(key, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	ser, err := yaml.Marshal(&cache)
+	if err != nil {
+		return err
+	}
+	return backend.Put("ac/"+target.ActionKey(cache.Inputs), bytes.NewReader(ser))
+}
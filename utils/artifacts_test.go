@@ -0,0 +1,80 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestActionKey(t *testing.T) {
+	defer func() { goEnvs, currentProject = map[string]map[string]string{}, nil }()
+	goEnvs = map[string]map[string]string{"": {"GOOS": "linux", "GOARCH": "amd64"}}
+	currentProject = &Project{Root: "/src/a", Module: "example.com/a"}
+
+	target := Target{Name: "build", Args: []string{"build"}, Outputs: []string{"bin/a"}}
+	inputs := map[string]FileState{
+		"main.go": {Mtime: 1, Size: 10, Hash: "aaaa"},
+		"util.go": {Mtime: 2, Size: 20, Hash: "bbbb"},
+	}
+	base := target.ActionKey(inputs)
+
+	tests := []struct {
+		name    string
+		project Project
+		target  Target
+		inputs  map[string]FileState
+		same    bool
+	}{
+		{"same inputs", Project{Root: "/src/a", Module: "example.com/a"}, target, inputs, true},
+		{"other checkout", Project{Root: "/src/b", Module: "example.com/a"}, target, inputs, true},
+		{"other file metadata", Project{Root: "/src/a", Module: "example.com/a"}, target, map[string]FileState{
+			"main.go": {Mtime: 3, Size: 10, Mode: 0644, Hash: "aaaa"},
+			"util.go": {Mtime: 4, Size: 20, Mode: 0644, Hash: "bbbb"},
+		}, true},
+		{"other module", Project{Root: "/src/a", Module: "example.com/b"}, target, inputs, false},
+		{"other target", Project{Root: "/src/a", Module: "example.com/a"}, Target{Name: "install", Args: []string{"build"}, Outputs: []string{"bin/a"}}, inputs, false},
+		{"changed input", Project{Root: "/src/a", Module: "example.com/a"}, target, map[string]FileState{
+			"main.go": {Mtime: 1, Size: 10, Hash: "cccc"},
+			"util.go": {Mtime: 2, Size: 20, Hash: "bbbb"},
+		}, false},
+		{"renamed input", Project{Root: "/src/a", Module: "example.com/a"}, target, map[string]FileState{
+			"main.go":  {Mtime: 1, Size: 10, Hash: "aaaa"},
+			"other.go": {Mtime: 2, Size: 20, Hash: "bbbb"},
+		}, false},
+		{"missing input", Project{Root: "/src/a", Module: "example.com/a"}, target, map[string]FileState{
+			"main.go": {Mtime: 1, Size: 10, Hash: "aaaa"},
+		}, false},
+	}
+	for _, test := range tests {
+		project := test.project
+		currentProject = &project
+		if key := test.target.ActionKey(test.inputs); (key == base) != test.same {
+			t.Errorf("%s: ActionKey = %s, base key %s, want same: %v", test.name, key, base, test.same)
+		}
+	}
+
+	currentProject = &Project{Root: "/src/a", Module: "example.com/a"}
+	slashed := map[string]FileState{filepath.Join("cmd", "main.go"): {Hash: "aaaa"}}
+	unslashed := map[string]FileState{"cmd/main.go": {Hash: "aaaa"}}
+	if target.ActionKey(slashed) != target.ActionKey(unslashed) {
+		t.Errorf("ActionKey depends on the path separator")
+	}
+}
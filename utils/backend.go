@@ -0,0 +1,235 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrCacheMiss is returned by a CacheBackend when no data is stored for a key.
+var ErrCacheMiss = errors.New("cache miss")
+
+// The CacheBackend interface describes a store for cache data. Keys are slash separated paths like
+// "ac/<digest>" and must not contain any other special characters.
+type CacheBackend interface {
+	// Get returns a reader for the data stored for the given key or ErrCacheMiss if no data is
+	// stored for the key. The caller has to close the reader.
+	Get(key string) (io.ReadCloser, error)
+
+	// Put stores the data read from r for the given key.
+	Put(key string, r io.Reader) error
+
+	// Exists checks whether data is stored for the given key.
+	Exists(key string) (bool, error)
+}
+
+// The FileBackend stores cache data as files inside a directory of the local filesystem.
+type FileBackend struct {
+	Dir string
+}
+
+// file returns the path of the file storing the data of the given key. Keys have to be clean
+// relative paths, so no key can refer to a file outside of the directory of the backend.
+func (backend FileBackend) file(key string) (string, error) {
+	if key == "" || key == ".." || strings.HasPrefix(key, "../") || path.IsAbs(key) ||
+		path.Clean(key) != key || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+	return filepath.Join(backend.Dir, filepath.FromSlash(key)), nil
+}
+
+// Get returns a reader for the file stored for the given key. The modification time of the file is
+// updated, so recently used data is kept when the cache gets pruned.
+func (backend FileBackend) Get(key string) (io.ReadCloser, error) {
+	name, err := backend.file(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, ErrCacheMiss
+	}
+	if err == nil {
+		now := time.Now()
+		_ = os.Chtimes(name, now, now)
+	}
+	return file, err
+}
+
+// Put stores the data read from r in the file for the given key. The file is replaced atomically,
+// so concurrent readers either see the old or the new data.
+func (backend FileBackend) Put(key string, r io.Reader) error {
+	name, err := backend.file(key)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(name, 0644, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// Exists checks whether a file is stored for the given key.
+func (backend FileBackend) Exists(key string) (bool, error) {
+	name, err := backend.file(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Remove deletes the data stored for the given key.
+func (backend FileBackend) Remove(key string) error {
+	name, err := backend.file(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// WriteFileAtomic writes a file by passing a temporary file in the same directory to write and
+// renaming it to path afterwards. If write returns an error, the file at path is left untouched.
+// Missing parent directories of path are created.
+func WriteFileAtomic(path string, mode os.FileMode, write func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// The HTTPBackend stores cache data on a remote server. Data is read with GET and written with PUT
+// requests to the URL of the server joined with the key.
+type HTTPBackend struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPBackend creates a new HTTPBackend for the server with the given URL.
+func NewHTTPBackend(url string) HTTPBackend {
+	return HTTPBackend{
+		URL:    strings.TrimSuffix(url, "/"),
+		Client: &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+// Get downloads the data stored for the given key.
+func (backend HTTPBackend) Get(key string) (io.ReadCloser, error) {
+	resp, err := backend.Client.Get(backend.URL + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrCacheMiss
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("GET %s/%s: %s", backend.URL, key, resp.Status)
+}
+
+// Put uploads the data read from r for the given key.
+func (backend HTTPBackend) Put(key string, r io.Reader) error {
+	req, err := http.NewRequest(http.MethodPut, backend.URL+"/"+key, r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := backend.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("PUT %s/%s: %s", backend.URL, key, resp.Status)
+	}
+	return nil
+}
+
+// Exists checks whether data is stored for the given key by sending a HEAD request.
+func (backend HTTPBackend) Exists(key string) (bool, error) {
+	resp, err := backend.Client.Head(backend.URL + "/" + key)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("HEAD %s/%s: %s", backend.URL, key, resp.Status)
+}
+
+// GetLocalBackend returns the backend storing the target caches of the current project on this
+// machine.
+func GetLocalBackend() (FileBackend, error) {
+	cacheDir, err := GetCacheDir()
+	if err != nil {
+		return FileBackend{}, err
+	}
+	return FileBackend{Dir: cacheDir}, nil
+}
+
+// GetRemoteBackend returns the shared cache backend configured in the burrow.yaml or nil if no
+// remote cache is configured.
+func GetRemoteBackend() CacheBackend {
+	if Config.Cache.Remote == "" {
+		return nil
+	}
+	return NewHTTPBackend(Config.Cache.Remote)
+}
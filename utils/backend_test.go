@@ -0,0 +1,89 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFileBackend(t *testing.T) {
+	backend := FileBackend{Dir: t.TempDir()}
+	if err := backend.Put("ac/entry", strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		data string
+		err  error
+	}{
+		{"ac/entry", "data", nil},
+		{"ac/missing", "", ErrCacheMiss},
+		{"missing/entry", "", ErrCacheMiss},
+	}
+	for _, test := range tests {
+		reader, err := backend.Get(test.key)
+		if err != test.err {
+			t.Errorf("Get(%q) returned error %v, want %v", test.key, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil || string(data) != test.data {
+			t.Errorf("Get(%q) = %q, %v, want %q", test.key, data, err, test.data)
+		}
+	}
+}
+
+func TestFileBackendKeys(t *testing.T) {
+	backend := FileBackend{Dir: t.TempDir()}
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"build-0123456789abcdef", true},
+		{"ac/0123", true},
+		{"cas/ab/cd", true},
+		{"", false},
+		{"..", false},
+		{"../outside", false},
+		{"ac/../../outside", false},
+		{"/etc/passwd", false},
+		{"./ac/0123", false},
+		{"ac//0123", false},
+		{"ac/", false},
+		{"ac\\0123", false},
+	}
+	for _, test := range tests {
+		err := backend.Put(test.key, strings.NewReader("data"))
+		if (err == nil) != test.valid {
+			t.Errorf("Put(%q) returned error %v, want valid %v", test.key, err, test.valid)
+		}
+		_, err = backend.Get(test.key)
+		if (err == nil) != test.valid {
+			t.Errorf("Get(%q) returned error %v, want valid %v", test.key, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The BenchDir is the directory the results of the benchmarks of every version and commit of the
+// project are stored in.
+var BenchDir = filepath.Join(".burrow", "bench")
+
+// The Benchmark struct describes the samples of a benchmark by unit, e.g. "ns/op" or "allocs/op".
+// Every run of the benchmark (go test -count) adds one sample to every unit.
+type Benchmark struct {
+	Package string               `json:"package"`
+	Name    string               `json:"name"`
+	Samples map[string][]float64 `json:"samples"`
+}
+
+// The BenchRun struct describes the results of the benchmarks of a version and commit of the project.
+type BenchRun struct {
+	Name       string      `json:"name"`
+	Version    string      `json:"version"`
+	Commit     string      `json:"commit,omitempty"`
+	Dirty      bool        `json:"dirty,omitempty"`
+	Date       time.Time   `json:"date"`
+	GoVersion  string      `json:"goversion,omitempty"`
+	Benchmarks []Benchmark `json:"benchmarks"`
+}
+
+// NewBenchRun creates an empty benchmark run of the current version and commit of the project. The
+// name of the run is the version followed by the abbreviated commit, e.g. "1.2.0-0123456789ab-dirty".
+func NewBenchRun() BenchRun {
+	info := GetBuildInfo(nil)
+	name := info.Version
+	if info.Commit != "" {
+		commit := info.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		name += "-" + commit
+	}
+	if info.Dirty {
+		name += "-dirty"
+	}
+	return BenchRun{
+		Name:       name,
+		Version:    info.Version,
+		Commit:     info.Commit,
+		Dirty:      info.Dirty,
+		Date:       time.Now(),
+		GoVersion:  info.GoVersion,
+		Benchmarks: []Benchmark{},
+	}
+}
+
+// Find returns the benchmark of a package with the given name. The flag is false if the run has no
+// such benchmark.
+func (run BenchRun) Find(pkg string, name string) (Benchmark, bool) {
+	for _, benchmark := range run.Benchmarks {
+		if benchmark.Package == pkg && benchmark.Name == name {
+			return benchmark, true
+		}
+	}
+	return Benchmark{}, false
+}
+
+// benchmark returns the benchmark of a package with the given name, which is added to the run if
+// necessary.
+func (run *BenchRun) benchmark(pkg string, name string) *Benchmark {
+	for i := range run.Benchmarks {
+		if run.Benchmarks[i].Package == pkg && run.Benchmarks[i].Name == name {
+			return &run.Benchmarks[i]
+		}
+	}
+	run.Benchmarks = append(run.Benchmarks, Benchmark{Package: pkg, Name: name, Samples: map[string][]float64{}})
+	return &run.Benchmarks[len(run.Benchmarks)-1]
+}
+
+// benchRunFile returns the path of the file the results of a benchmark run are stored in.
+func benchRunFile(name string) string {
+	return filepath.Join(BenchDir, strings.Replace(name, "/", "_", -1)+".json")
+}
+
+// Write stores the results of the benchmark run. Earlier results of a run with the same name are
+// replaced.
+func (run BenchRun) Write() error {
+	return WriteFileAtomic(benchRunFile(run.Name), 0644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(run)
+	})
+}
+
+// ReadBenchRuns returns all stored benchmark runs of the project, the most recent run first.
+func ReadBenchRuns() ([]BenchRun, error) {
+	files, err := ioutil.ReadDir(BenchDir)
+	if os.IsNotExist(err) {
+		return []BenchRun{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []BenchRun{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(BenchDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		run := BenchRun{}
+		if err := json.Unmarshal(data, &run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Date.After(runs[j].Date)
+	})
+	return runs, nil
+}
+
+// FindBenchRun returns the most recent stored benchmark run matching the reference, which is the name
+// or version of a run or a prefix of its commit. Without reference the most recent run is returned.
+// The flag is false if no run matches.
+func FindBenchRun(ref string) (BenchRun, bool, error) {
+	runs, err := ReadBenchRuns()
+	if err != nil {
+		return BenchRun{}, false, err
+	}
+	for _, run := range runs {
+		if ref == "" || run.Name == ref || run.Version == ref ||
+			(len(ref) >= 4 && run.Commit != "" && strings.HasPrefix(run.Commit, ref)) {
+			return run, true, nil
+		}
+	}
+	return BenchRun{}, false, nil
+}
+
+// The BenchRecorder struct reads the output of 'go test -bench' and collects the samples of all
+// benchmarks into a benchmark run. The output is logged as it is.
+type BenchRecorder struct {
+	target  string
+	mutex   sync.Mutex
+	partial []byte
+	pkg     string
+	run     *BenchRun
+}
+
+// NewBenchRecorder creates a benchmark recorder that adds the samples to the run and logs the output
+// with the given target.
+func NewBenchRecorder(target string, run *BenchRun) *BenchRecorder {
+	return &BenchRecorder{target: target, run: run}
+}
+
+// Write reads the lines of the output of 'go test -bench'.
+func (recorder *BenchRecorder) Write(payload []byte) (int, error) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.partial = append(recorder.partial, payload...)
+	for {
+		index := bytes.IndexByte(recorder.partial, '\n')
+		if index < 0 {
+			break
+		}
+		line := string(bytes.TrimRight(recorder.partial[:index], "\r"))
+		recorder.partial = recorder.partial[index+1:]
+
+		if strings.TrimSpace(line) != "" {
+			Log(LOG_INFO, recorder.target, "%s", line)
+		}
+		recorder.handle(line)
+	}
+	return len(payload), nil
+}
+
+// handle records the samples of a single line of benchmark output. A result line consists of the
+// name of the benchmark, the number of iterations and pairs of values and units, e.g.
+// "BenchmarkParse-8  1000  1234 ns/op  16 B/op  1 allocs/op". The GOMAXPROCS suffix of the name
+// ("-8") is dropped, so results of machines with a different number of CPUs can be compared.
+func (recorder *BenchRecorder) handle(line string) {
+	if strings.HasPrefix(line, "pkg: ") {
+		recorder.pkg = strings.TrimSpace(strings.TrimPrefix(line, "pkg: "))
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+		return
+	}
+	if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return
+	}
+
+	values := map[string]float64{}
+	for i := 2; i < len(fields); i += 2 {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return
+		}
+		values[fields[i+1]] = value
+	}
+	benchmark := recorder.run.benchmark(recorder.pkg, trimProcs(fields[0]))
+	for unit, value := range values {
+		benchmark.Samples[unit] = append(benchmark.Samples[unit], value)
+	}
+}
+
+// trimProcs removes the GOMAXPROCS suffix that 'go test' appends to the name of a benchmark, e.g.
+// BenchmarkParse-8 becomes BenchmarkParse.
+func trimProcs(name string) string {
+	index := strings.LastIndex(name, "-")
+	if index < 0 || index == len(name)-1 {
+		return name
+	}
+	if _, err := strconv.Atoi(name[index+1:]); err != nil {
+		return name
+	}
+	return name[:index]
+}
@@ -0,0 +1,85 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrimProcs(t *testing.T) {
+	tests := []struct {
+		name    string
+		trimmed string
+	}{
+		{"BenchmarkParse-8", "BenchmarkParse"},
+		{"BenchmarkParse-128", "BenchmarkParse"},
+		{"BenchmarkParse", "BenchmarkParse"},
+		{"BenchmarkParse/size=10-4", "BenchmarkParse/size=10"},
+		{"BenchmarkParse/a-b-2", "BenchmarkParse/a-b"},
+		{"BenchmarkParse/a-b", "BenchmarkParse/a-b"},
+		{"BenchmarkParse-", "BenchmarkParse-"},
+	}
+	for _, test := range tests {
+		if trimmed := trimProcs(test.name); trimmed != test.trimmed {
+			t.Errorf("trimProcs(%q) = %q, want %q", test.name, trimmed, test.trimmed)
+		}
+	}
+}
+
+func TestBenchRecorder(t *testing.T) {
+	run := BenchRun{Benchmarks: []Benchmark{}}
+	recorder := NewBenchRecorder("bench", &run)
+	output := "goos: linux\n" +
+		"pkg: example.com/a\n" +
+		"BenchmarkParse-8   \t 1000\t 1200 ns/op\t 16 B/op\t 1 allocs/op\n" +
+		"BenchmarkParse-8   \t 1000\t 1300 ns/op\t 16 B/op\t 1 allocs/op\r\n" +
+		"BenchmarkParse/small-8 \t 5000\t 200 ns/op\n" +
+		"BenchmarkBroken-8 \t fast\t 200 ns/op\n" +
+		"PASS\n" +
+		"pkg: example.com/b\n" +
+		"BenchmarkParse \t 10\t 5.5 MB/s\n"
+	for _, chunk := range []string{output[:20], output[20:90], output[90:]} {
+		if _, err := recorder.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []Benchmark{
+		{Package: "example.com/a", Name: "BenchmarkParse", Samples: map[string][]float64{
+			"ns/op": {1200, 1300}, "B/op": {16, 16}, "allocs/op": {1, 1},
+		}},
+		{Package: "example.com/a", Name: "BenchmarkParse/small", Samples: map[string][]float64{"ns/op": {200}}},
+		{Package: "example.com/b", Name: "BenchmarkParse", Samples: map[string][]float64{"MB/s": {5.5}}},
+	}
+	if !reflect.DeepEqual(run.Benchmarks, expected) {
+		t.Errorf("recorded benchmarks = %+v, want %+v", run.Benchmarks, expected)
+	}
+
+	if benchmark, ok := run.Find("example.com/b", "BenchmarkParse"); !ok || !reflect.DeepEqual(benchmark, expected[2]) {
+		t.Errorf("Find(example.com/b, BenchmarkParse) = %+v, %v", benchmark, ok)
+	}
+	if _, ok := run.Find("example.com/b", "BenchmarkMissing"); ok {
+		t.Errorf("Find found a benchmark that was not recorded")
+	}
+	if len(run.Benchmarks) != len(expected) {
+		t.Errorf("Find added a benchmark to the run")
+	}
+}
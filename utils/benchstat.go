@@ -0,0 +1,173 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// The BenchSummary struct summarizes the samples of a benchmark like benchstat: outliers are removed
+// and the Diff is the largest deviation of the remaining samples (Values) from their Mean, relative
+// to the mean.
+type BenchSummary struct {
+	Mean   float64
+	Diff   float64
+	Values []float64
+}
+
+// SummarizeSamples removes the outliers of the samples, i.e. the samples more than 1.5 times the
+// interquartile range below the first or above the third quartile, and summarizes the rest.
+func SummarizeSamples(samples []float64) BenchSummary {
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	if len(sorted) == 0 {
+		return BenchSummary{}
+	}
+
+	q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+	low, high := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	summary := BenchSummary{Values: []float64{}}
+	for _, value := range sorted {
+		if value >= low && value <= high {
+			summary.Values = append(summary.Values, value)
+			summary.Mean += value
+		}
+	}
+	summary.Mean /= float64(len(summary.Values))
+
+	if summary.Mean != 0 {
+		min, max := summary.Values[0], summary.Values[len(summary.Values)-1]
+		summary.Diff = math.Max(max-summary.Mean, summary.Mean-min) / math.Abs(summary.Mean)
+	}
+	return summary
+}
+
+// quantile returns the q-quantile of sorted samples, interpolating linearly between two samples.
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	return sorted[lower] + (position-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// MannWhitneyU returns the two-sided p-value of the Mann-Whitney U test, i.e. the probability that
+// the difference between the two samples is caused by chance only. Small samples without ties use the
+// exact distribution of U, all other samples the normal approximation with tie correction.
+func MannWhitneyU(a []float64, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type sample struct {
+		value float64
+		first bool
+	}
+	samples := make([]sample, 0, n1+n2)
+	for _, value := range a {
+		samples = append(samples, sample{value, true})
+	}
+	for _, value := range b {
+		samples = append(samples, sample{value, false})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+
+	// tied samples get the mean of the ranks they span
+	rankSum := 0.0
+	tieCorrection := 0.0
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if samples[k].first {
+				rankSum += rank
+			}
+		}
+		ties := float64(j - i)
+		tieCorrection += ties*ties*ties - ties
+		i = j
+	}
+	u := rankSum - float64(n1*(n1+1))/2
+
+	if tieCorrection == 0 && n1 <= 30 && n2 <= 30 {
+		return mannWhitneyExact(u, n1, n2)
+	}
+
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := math.Max(math.Abs(u-mean)-0.5, 0) / math.Sqrt(variance)
+	return math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// mannWhitneyExact returns the two-sided p-value of the statistic u of the Mann-Whitney U test for
+// samples of the sizes n1 and n2 without ties, based on the number of rank orders resulting in every
+// value of U.
+func mannWhitneyExact(u float64, n1 int, n2 int) float64 {
+	// counts[j][k] is the number of rank orders of samples of the sizes i and j with U = k
+	counts := make([][]float64, n2+1)
+	for j := range counts {
+		counts[j] = make([]float64, n1*n2+1)
+		counts[j][0] = 1
+	}
+	for i := 1; i <= n1; i++ {
+		next := make([][]float64, n2+1)
+		next[0] = make([]float64, n1*n2+1)
+		next[0][0] = 1
+		for j := 1; j <= n2; j++ {
+			next[j] = make([]float64, n1*n2+1)
+			for k := 0; k <= i*j; k++ {
+				next[j][k] = next[j-1][k]
+				if k >= j {
+					next[j][k] += counts[j][k-j]
+				}
+			}
+		}
+		counts = next
+	}
+
+	total, lower, upper := 0.0, 0.0, 0.0
+	for k, count := range counts[n2] {
+		total += count
+		if float64(k) <= u {
+			lower += count
+		}
+		if float64(k) >= u {
+			upper += count
+		}
+	}
+	return math.Min(1, 2*math.Min(lower, upper)/total)
+}
+
+// HigherIsBetter returns whether larger values of a benchmark unit are an improvement, which is the
+// case for rates like "MB/s".
+func HigherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
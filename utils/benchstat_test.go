@@ -0,0 +1,80 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// sequence returns the values from..to.
+func sequence(from int, to int) []float64 {
+	values := []float64{}
+	for i := from; i <= to; i++ {
+		values = append(values, float64(i))
+	}
+	return values
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []float64
+		b    []float64
+		p    float64
+	}{
+		{"empty", nil, []float64{1, 2}, 1},
+		{"separated", sequence(1, 5), sequence(6, 10), 2.0 / 252},
+		{"separated reversed", sequence(6, 10), sequence(1, 5), 2.0 / 252},
+		{"interleaved", []float64{1, 3, 5, 7, 9}, []float64{2, 4, 6, 8, 10}, 0.6904761904761905},
+		{"ties use the normal approximation", []float64{1, 2, 2, 3}, []float64{2, 3, 4, 5}, 0.13665824773814753},
+		{"all equal", []float64{3, 3, 3}, []float64{3, 3, 3}, 1},
+		{"30 samples use the exact distribution", sequence(1, 30), sequence(31, 60), 1.6911233892144735e-17},
+		{"31 samples use the normal approximation", sequence(1, 30), sequence(31, 61), 2.0701106196976567e-11},
+	}
+	for _, test := range tests {
+		p := MannWhitneyU(test.a, test.b)
+		if math.Abs(p-test.p) > 1e-9*test.p {
+			t.Errorf("%s: MannWhitneyU(%v, %v) = %g, want %g", test.name, test.a, test.b, p, test.p)
+		}
+	}
+}
+
+func TestSummarizeSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float64
+		summary BenchSummary
+	}{
+		{"empty", nil, BenchSummary{}},
+		{"single", []float64{5}, BenchSummary{Mean: 5, Diff: 0, Values: []float64{5}}},
+		{"outlier", []float64{100, 101, 99, 102, 500}, BenchSummary{Mean: 100.5, Diff: 1.5 / 100.5, Values: []float64{99, 100, 101, 102}}},
+		{"low outlier", []float64{1, 100, 101, 99, 102}, BenchSummary{Mean: 100.5, Diff: 1.5 / 100.5, Values: []float64{99, 100, 101, 102}}},
+		{"zero mean", []float64{-1, 1}, BenchSummary{Mean: 0, Diff: 0, Values: []float64{-1, 1}}},
+	}
+	for _, test := range tests {
+		summary := SummarizeSamples(test.samples)
+		if math.Abs(summary.Mean-test.summary.Mean) > 1e-9 || math.Abs(summary.Diff-test.summary.Diff) > 1e-9 ||
+			!reflect.DeepEqual(summary.Values, test.summary.Values) {
+			t.Errorf("%s: SummarizeSamples(%v) = %+v, want %+v", test.name, test.samples, summary, test.summary)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// IsSourceFile returns whether the package of a binary is a single go file instead of a package
+// directory.
+func (binary Binary) IsSourceFile() bool {
+	return strings.HasSuffix(binary.Package, ".go")
+}
+
+// PackageDir returns the directory of the package of a binary in the form "./dir".
+func (binary Binary) PackageDir() string {
+	dir := filepath.ToSlash(binary.Package)
+	if binary.IsSourceFile() {
+		dir = path.Dir(dir)
+	}
+	dir = path.Clean(dir)
+	if dir == "." {
+		return "."
+	}
+	return "./" + strings.TrimPrefix(dir, "./")
+}
+
+// PgoFile returns the path of the default.pgo of the package of a binary, which is the CPU profile
+// used for profile-guided optimization. The flag is false if the file does not exist.
+func (binary Binary) PgoFile() (string, bool) {
+	file := binary.PackageDir() + "/default.pgo"
+	if info, err := os.Stat(file); err != nil || info.IsDir() {
+		return file, false
+	}
+	return file, true
+}
+
+// PgoArgs returns the -pgo flag for building a binary. With enabled profile-guided optimization it
+// passes the default.pgo of the package of the binary, otherwise it turns the optimization off, as
+// the go tool uses an existing default.pgo by default. Without default.pgo no flag is needed.
+func (binary Binary) PgoArgs(enabled bool) []string {
+	file, ok := binary.PgoFile()
+	switch {
+	case !ok:
+		return nil
+	case enabled:
+		return []string{"-pgo=" + file}
+	}
+	return []string{"-pgo=off"}
+}
+
+// BuildArgs returns the go build arguments of a binary without the package, i.e. its flags and tags.
+// The additional tags (e.g. of a profile) are merged with the tags of the binary.
+func (binary Binary) BuildArgs(tags ...string) ([]string, error) {
+	args, err := shellwords.Parse(binary.Flags)
+	if err != nil {
+		return nil, err
+	}
+	if tags = binary.AllTags(tags...); len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+	return args, nil
+}
+
+// AllTags returns the build tags of a binary merged with the additional tags.
+func (binary Binary) AllTags(tags ...string) []string {
+	return append(append([]string{}, tags...), binary.Tags...)
+}
+
+// GetBinaries returns the binaries of the project sorted by name. If the burrow.yaml lists binaries
+// only those are returned. Otherwise every main package of the project is a binary: the package in
+// the project root is named after the project, the single-file examples in example/ are named
+// example/<file> and every other package is named after its directory.
+func GetBinaries() ([]Binary, error) {
+	LoadConfig()
+	if len(Config.Binaries) > 0 {
+		binaries := append([]Binary{}, Config.Binaries...)
+		for i, binary := range binaries {
+			if binary.Name == "" || binary.Package == "" {
+				return nil, fmt.Errorf("binary %d of the burrow.yaml needs a name and a package", i+1)
+			}
+		}
+		sort.Slice(binaries, func(i, j int) bool { return binaries[i].Name < binaries[j].Name })
+		return binaries, checkBinaryNames(binaries, "rename one of them in the burrow.yaml")
+	}
+
+	packages, err := ListPackages(nil, "./...")
+	if err != nil {
+		return nil, err
+	}
+
+	wd, _ := os.Getwd()
+	binaries := []Binary{}
+	dirs := map[string][]int{}
+	for _, pkg := range packages {
+		if pkg.Name != "main" || !pkg.IsLocal() {
+			continue
+		}
+		dir, err := filepath.Rel(wd, pkg.Dir)
+		if err != nil || IsIgnored(dir) {
+			continue
+		}
+		dir = filepath.ToSlash(dir)
+
+		switch dir {
+		case ".":
+			binaries = append(binaries, Binary{Name: Config.Name, Package: "."})
+		case "example":
+			for _, file := range pkg.GoFiles {
+				binaries = append(binaries, Binary{
+					Name:    "example/" + strings.TrimSuffix(file, ".go"),
+					Package: "example/" + file,
+				})
+			}
+		default:
+			name := path.Base(dir)
+			if strings.HasPrefix(dir, "example/") {
+				name = dir
+			}
+			dirs[name] = append(dirs[name], len(binaries))
+			binaries = append(binaries, Binary{Name: name, Package: "./" + dir})
+		}
+	}
+
+	// packages in different directories with the same name keep their relative path
+	for _, indices := range dirs {
+		if len(indices) > 1 {
+			for _, i := range indices {
+				binaries[i].Name = strings.TrimPrefix(binaries[i].Package, "./")
+			}
+		}
+	}
+
+	sort.Slice(binaries, func(i, j int) bool { return binaries[i].Name < binaries[j].Name })
+	return binaries, checkBinaryNames(binaries, "list the binaries with distinct names in the burrow.yaml")
+}
+
+// checkBinaryNames returns an error if two of the sorted binaries have the same name, because they
+// would be built to the same file. The hint tells the user how to resolve the collision.
+func checkBinaryNames(binaries []Binary, hint string) error {
+	for i := 1; i < len(binaries); i++ {
+		if binaries[i].Name == binaries[i-1].Name {
+			return fmt.Errorf("the packages %s and %s are both built as binary %s, %s",
+				binaries[i-1].Package, binaries[i].Package, binaries[i].Name, hint)
+		}
+	}
+	return nil
+}
+
+// FindBinary returns the binary with the given name. The prefix example/ may be omitted.
+func FindBinary(binaries []Binary, name string) (Binary, bool) {
+	for _, candidate := range []string{"example/" + name, name} {
+		for _, binary := range binaries {
+			if binary.Name == candidate {
+				return binary, true
+			}
+		}
+	}
+	return Binary{}, false
+}
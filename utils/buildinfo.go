@@ -0,0 +1,276 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The defaultBuildInfoVars map the build metadata to the variables they are injected into when the
+// burrow.yaml does not name other variables.
+var defaultBuildInfoVars = map[string]string{
+	"version":   "main.version",
+	"commit":    "main.commit",
+	"dirty":     "main.dirty",
+	"date":      "main.date",
+	"goversion": "main.goVersion",
+}
+
+// The BuildInfo struct describes the version and build metadata that is injected into binaries.
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	Dirty     bool
+	Date      string
+	GoVersion string
+}
+
+// GetBuildInfo collects the build metadata of the project. The env contains additional environment
+// variables (e.g. GOOS) the binaries are built with. The build date is taken from
+// SOURCE_DATE_EPOCH in env or in the environment of burrow, the time of the last commit or the
+// current day, in this order, so that repeated builds of the same commit inject the same date.
+func GetBuildInfo(env []string) BuildInfo {
+	LoadConfig()
+	info := BuildInfo{
+		Version:   Config.Version,
+		GoVersion: GetGoEnvFor(env)["GOVERSION"],
+	}
+
+	if out, err := ExecOutput("git", "rev-parse", "HEAD"); err == nil {
+		info.Commit = strings.TrimSpace(string(out))
+	}
+	if out, err := ExecOutput("git", "status", "--porcelain", "--untracked-files=no"); err == nil {
+		info.Dirty = len(bytes.TrimSpace(out)) > 0
+	}
+
+	date, ok := GetSourceDate(env)
+	if !ok {
+		date = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	info.Date = date.Format(time.RFC3339)
+	return info
+}
+
+// GetSourceDate returns the date of the sources, which is taken from SOURCE_DATE_EPOCH or the time of
+// the last commit. A SOURCE_DATE_EPOCH in the additional environment variables (env) takes precedence
+// over the one of the environment of burrow. The flag is false if no date is available.
+func GetSourceDate(env []string) (time.Time, bool) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	for _, variable := range env {
+		if strings.HasPrefix(variable, "SOURCE_DATE_EPOCH=") {
+			epoch = strings.TrimPrefix(variable, "SOURCE_DATE_EPOCH=")
+		}
+	}
+	if epoch, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC(), true
+	}
+	if out, err := ExecOutput("git", "log", "-1", "--format=%ct"); err == nil {
+		if epoch, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64); err == nil {
+			return time.Unix(epoch, 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// GetSourceDateEpoch returns the value of SOURCE_DATE_EPOCH for reproducible builds. It is taken
+// from the environment of burrow or the time of the last commit, and is 0 if neither is available.
+func GetSourceDateEpoch() string {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		return epoch
+	}
+	if date, ok := GetSourceDate(nil); ok {
+		return strconv.FormatInt(date.Unix(), 10)
+	}
+	return "0"
+}
+
+// values returns the build metadata by the names used in the burrow.yaml.
+func (info BuildInfo) values() map[string]string {
+	return map[string]string{
+		"version":   info.Version,
+		"commit":    info.Commit,
+		"dirty":     strconv.FormatBool(info.Dirty),
+		"date":      info.Date,
+		"goversion": info.GoVersion,
+	}
+}
+
+// LdFlags returns the -X linker flags that inject the build metadata into the variables configured
+// in the burrow.yaml and into the generated buildinfo package, if there is one. An error is returned
+// if a value cannot be quoted for the linker.
+func (info BuildInfo) LdFlags() (string, error) {
+	vars := map[string]string{}
+	for name, variable := range defaultBuildInfoVars {
+		vars[name] = variable
+	}
+	for name, variable := range Config.Build.Info.Variables {
+		vars[name] = variable
+	}
+
+	flags := []string{}
+	values := info.values()
+	for _, name := range sortedNames(vars) {
+		if vars[name] == "" {
+			continue
+		}
+		flag, err := ldflag(vars[name], values[name])
+		if err != nil {
+			return "", err
+		}
+		flags = append(flags, flag)
+	}
+
+	if pkg := buildInfoImportPath(); pkg != "" {
+		fields := map[string]string{
+			"version": "Version", "commit": "Commit", "dirty": "Dirty", "date": "Date", "goversion": "GoVersion",
+		}
+		for _, name := range sortedNames(fields) {
+			flag, err := ldflag(pkg+"."+fields[name], values[name])
+			if err != nil {
+				return "", err
+			}
+			flags = append(flags, flag)
+		}
+	}
+	return strings.Join(flags, " "), nil
+}
+
+// ldflag returns a -X linker flag that sets the variable to the value. The go tool splits -ldflags
+// like a shell, so the flag is double-quoted if it contains spaces or quotes, or single-quoted if it
+// contains double quotes. A flag containing both kinds of quotes cannot be passed to the linker.
+func ldflag(variable string, value string) (string, error) {
+	flag := variable + "=" + value
+	switch {
+	case strings.Contains(flag, "'") && strings.Contains(flag, "\""):
+		return "", fmt.Errorf("cannot quote the value %q of %s", value, variable)
+	case strings.Contains(flag, "\""):
+		return "-X '" + flag + "'", nil
+	case strings.ContainsAny(flag, " \t'"):
+		return "-X \"" + flag + "\"", nil
+	}
+	return "-X " + flag, nil
+}
+
+// sortedNames returns the keys of a map in sorted order.
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// buildInfoImportPath returns the import path of the generated buildinfo package or an empty string
+// if no package is configured.
+func buildInfoImportPath() string {
+	dir := Config.Build.Info.Package
+	if dir == "" {
+		return ""
+	}
+	project, err := GetProject()
+	if err != nil || project.Module == "" {
+		return ""
+	}
+	return path.Join(project.Module, filepath.ToSlash(dir))
+}
+
+// GenerateBuildInfoPackage writes the buildinfo package configured in the burrow.yaml. The file is
+// only written when its content changed, so that it does not invalidate the target cache.
+func GenerateBuildInfoPackage() error {
+	dir := Config.Build.Info.Package
+	if dir == "" {
+		return nil
+	}
+
+	name := path.Base(filepath.ToSlash(dir))
+	content := fmt.Sprintf(buildInfoTemplate, name)
+	file := filepath.Join(dir, "buildinfo.go")
+	if existing, err := ioutil.ReadFile(file); err == nil && string(existing) == content {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(file, 0644, func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	})
+}
+
+// The buildInfoTemplate is the content of the generated buildinfo package.
+const buildInfoTemplate = `// Code generated by burrow. DO NOT EDIT.
+
+// Package %[1]s contains the version and build metadata that burrow injects when building the
+// application.
+package %[1]s
+
+import "strings"
+
+// The variables are set with -ldflags -X when the application is built by burrow.
+var (
+	// Version is the version of the application from the burrow.yaml.
+	Version = "unknown"
+	// Commit is the git commit the application was built from.
+	Commit string
+	// Dirty is "true" if the working tree had uncommitted changes.
+	Dirty string
+	// Date is the build date in RFC 3339 format.
+	Date string
+	// GoVersion is the version of the go toolchain.
+	GoVersion string
+)
+
+// String returns a human readable description of the build, suitable for a --version flag.
+func String() string {
+	details := []string{}
+	if Commit != "" {
+		commit := Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if Dirty == "true" {
+			commit += "-dirty"
+		}
+		details = append(details, "commit "+commit)
+	}
+	if Date != "" {
+		details = append(details, "built "+Date)
+	}
+	if GoVersion != "" {
+		details = append(details, GoVersion)
+	}
+	if len(details) == 0 {
+		return Version
+	}
+	return Version + " (" + strings.Join(details, ", ") + ")"
+}
+`
@@ -0,0 +1,44 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import "testing"
+
+func TestLdflag(t *testing.T) {
+	tests := []struct {
+		value string
+		flag  string
+		err   bool
+	}{
+		{"1.0.0", "-X main.version=1.0.0", false},
+		{"", "-X main.version=", false},
+		{"1.0.0 beta", `-X "main.version=1.0.0 beta"`, false},
+		{"1.0.0\tbeta", "-X \"main.version=1.0.0\tbeta\"", false},
+		{"it's", `-X "main.version=it's"`, false},
+		{`"quoted" beta`, `-X 'main.version="quoted" beta'`, false},
+		{`it's "quoted"`, "", true},
+	}
+	for _, test := range tests {
+		flag, err := ldflag("main.version", test.value)
+		if (err != nil) != test.err || flag != test.flag {
+			t.Errorf("ldflag(%q) = %q, %v, want %q (error: %v)", test.value, flag, err, test.flag, test.err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The CacheEntry struct describes a single target cache file of the current project.
+type CacheEntry struct {
+	Key     string
+	Path    string
+	ModTime time.Time
+	Size    int64
+	Cache   TargetCache
+	Err     error
+}
+
+// Status returns why the target of the cache entry would be rebuilt, or an empty string if the
+// cached state still matches the current state of the project. Only files known to the cache entry
+// are compared, new inputs of a target are detected when the target itself is run.
+func (entry CacheEntry) Status() string {
+	if entry.Err != nil {
+		return fmt.Sprintf("unreadable cache entry: %s", entry.Err)
+	}
+
+	env := GetGoEnvFor(entry.Cache.Overrides)
+	for _, name := range goEnvVars {
+		if entry.Cache.Env[name] != env[name] {
+			return fmt.Sprintf("go environment changed (%s)", name)
+		}
+	}
+
+	if reason := describeChanges("input", sortedKeys(entry.Cache.Inputs), entry.Cache.Inputs); reason != "" {
+		return reason
+	}
+	return describeChanges("output", sortedKeys(entry.Cache.Outputs), entry.Cache.Outputs)
+}
+
+// ListCacheEntries returns all target cache entries of the current project sorted by target name
+// and age.
+func ListCacheEntries() ([]CacheEntry, error) {
+	cacheDir, err := GetCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []CacheEntry{}
+	for _, file := range files {
+		if file.IsDir() || file.Name() == "project.yaml" || file.Name() == "lock" || file.Name()[0] == '.' {
+			continue
+		}
+
+		entry := CacheEntry{
+			Key:     file.Name(),
+			Path:    filepath.Join(cacheDir, file.Name()),
+			ModTime: file.ModTime(),
+			Size:    file.Size(),
+		}
+		entry.Cache, entry.Err = readTargetCache(entry.Path)
+		if entry.Cache.Target == "" {
+			entry.Cache.Target = targetOfKey(entry.Key)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Cache.Target != entries[j].Cache.Target {
+			return entries[i].Cache.Target < entries[j].Cache.Target
+		}
+		return entries[i].ModTime.After(entries[j].ModTime)
+	})
+	return entries, nil
+}
+
+// ClearCache removes all cache entries of the given target from the cache of the current project,
+// including the entries referencing stored outputs. If target is empty, the whole cache of the
+// project including all stored outputs is removed. The number of removed entries is returned. The
+// caller has to hold the project lock, see LockProject.
+func ClearCache(target string) (int, error) {
+	entries, err := ListCacheEntries()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if target != "" && entry.Cache.Target != target {
+			continue
+		}
+		if err := os.Remove(entry.Path); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	cacheDir, err := GetCacheDir()
+	if err != nil {
+		return removed, err
+	}
+	actions := filepath.Join(cacheDir, "ac")
+	err = filepath.Walk(actions, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() {
+			return nil
+		}
+		if target != "" {
+			if cache, err := readTargetCache(path); err == nil && cache.Target != target {
+				return nil
+			}
+		}
+		removed++
+		return os.Remove(path)
+	})
+	if err != nil {
+		return removed, err
+	}
+	if target == "" {
+		if err := os.RemoveAll(filepath.Join(cacheDir, "cas")); err != nil {
+			return removed, err
+		}
+	}
+
+	targetStateMutex.Lock()
+	for key := range targetState {
+		if target == "" || targetOfKey(key) == target {
+			delete(targetState, key)
+		}
+	}
+	targetStateMutex.Unlock()
+
+	return removed, nil
+}
+
+// PruneCaches garbage-collects the caches of all projects on this machine. Cache directories of
+// projects that do not exist anymore are removed completely, from all other cache directories the
+// entries that have not been used for longer than maxAge and the stored outputs no remaining entry
+// references are removed. The paths of all removed cache directories and entries are returned.
+func PruneCaches(maxAge time.Duration) ([]string, error) {
+	cacheRoot, err := GetCacheRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, err := ioutil.ReadDir(cacheRoot)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	deadline := time.Now().Add(-maxAge)
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		pruned, err := pruneCacheDir(filepath.Join(cacheRoot, dir.Name()), deadline)
+		removed = append(removed, pruned...)
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// pruneCacheDir prunes the cache directory of a single project while holding the lock of the
+// project, so no burrow process uses the cache at the same time. Entries are removed when they were
+// last used before the deadline. Stored outputs are only removed when none of the remaining entries
+// references them, otherwise restoring the entry would fail.
+func pruneCacheDir(cacheDir string, deadline time.Time) ([]string, error) {
+	lock, err := lockCacheDir(cacheDir, defaultLockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockCacheDir(lock)
+
+	if !isProjectAlive(cacheDir) {
+		return removeCacheDir(cacheDir)
+	}
+
+	removed := []string{}
+	referenced := map[string]bool{}
+	outputs := filepath.Join(cacheDir, "cas")
+	err = filepath.Walk(cacheDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			if path == outputs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if f.Name() == "project.yaml" || f.Name() == "lock" {
+			return nil
+		}
+		if f.ModTime().Before(deadline) {
+			removed = append(removed, path)
+			return os.Remove(path)
+		}
+		if cache, err := readTargetCache(path); err == nil {
+			for _, state := range cache.Outputs {
+				referenced[state.Hash] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	files, err := ioutil.ReadDir(outputs)
+	if os.IsNotExist(err) {
+		return removed, nil
+	}
+	if err != nil {
+		return removed, err
+	}
+	for _, file := range files {
+		if file.IsDir() || referenced[file.Name()] {
+			continue
+		}
+		path := filepath.Join(outputs, file.Name())
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// removeCacheDir removes the cache directory of a project that does not exist anymore. The caller
+// has to hold the lock of the cache directory, the lock file is removed last, so a burrow process
+// waiting for the lock notices that the lock file was removed and creates a new one, see
+// lockCacheDir. Some systems cannot remove the open lock file, then the directory is kept.
+func removeCacheDir(cacheDir string) ([]string, error) {
+	files, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Name() == "lock" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(cacheDir, file.Name())); err != nil {
+			return nil, err
+		}
+	}
+
+	if os.Remove(filepath.Join(cacheDir, "lock")) != nil {
+		return nil, nil
+	}
+	return []string{cacheDir}, os.Remove(cacheDir)
+}
+
+// ParseAge parses a duration that additionally supports days (e.g. 30d) as unit.
+func ParseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", age)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(age)
+}
+
+// isProjectAlive checks whether the project a cache directory belongs to still exists. Cache
+// directories without a project.yaml were created by older versions of burrow and cannot be mapped
+// to a project anymore.
+func isProjectAlive(cacheDir string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(cacheDir, "project.yaml"))
+	if err != nil {
+		return false
+	}
+
+	project := Project{}
+	if err := yaml.Unmarshal(data, &project); err != nil || project.Root == "" {
+		return false
+	}
+
+	for _, file := range []string{"burrow.yaml", "go.mod"} {
+		if _, err := os.Stat(filepath.Join(project.Root, file)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// targetOfKey returns the target name a cache key belongs to.
+func targetOfKey(key string) string {
+	if i := strings.LastIndex(key, "-"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
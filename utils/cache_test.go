@@ -0,0 +1,136 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age      string
+		duration time.Duration
+		err      bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"12h", 12 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"30", 0, true},
+		{"", 0, true},
+		{"week", 0, true},
+	}
+	for _, test := range tests {
+		duration, err := ParseAge(test.age)
+		if (err != nil) != test.err || duration != test.duration {
+			t.Errorf("ParseAge(%q) = %v, %v, want %v (error: %v)", test.age, duration, err, test.duration, test.err)
+		}
+	}
+}
+
+func TestIsProjectAlive(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "project")
+	if err := os.Mkdir(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(project, "go.mod"), []byte("module example.com/p\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		alive   bool
+	}{
+		{"existing project", "root: " + project + "\n", true},
+		{"removed project", "root: " + filepath.Join(root, "removed") + "\n", false},
+		{"no root", "name: p\n", false},
+		{"invalid yaml", "root: [\n", false},
+		{"no project.yaml", "", false},
+	}
+	for i, test := range tests {
+		cacheDir := filepath.Join(root, "cache", string(rune('a'+i)))
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if test.content != "" {
+			if err := ioutil.WriteFile(filepath.Join(cacheDir, "project.yaml"), []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if alive := isProjectAlive(cacheDir); alive != test.alive {
+			t.Errorf("%s: isProjectAlive = %v, want %v", test.name, alive, test.alive)
+		}
+	}
+}
+
+func TestPruneCacheDir(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/p\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := filepath.Join(root, "cache")
+	if err := os.MkdirAll(filepath.Join(cacheDir, "cas"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	files := []struct {
+		name    string
+		content string
+		old     bool
+		kept    bool
+	}{
+		{"project.yaml", "root: " + root + "\n", true, true},
+		{"build-used", "outputs:\n  bin/p:\n    hash: used\n", false, true},
+		{"build-stale", "outputs:\n  bin/p:\n    hash: stale\n", true, false},
+		{"cas/used", "binary", true, true},
+		{"cas/stale", "binary", true, false},
+		{"cas/fresh", "binary", false, false},
+	}
+	for _, file := range files {
+		path := filepath.Join(cacheDir, filepath.FromSlash(file.name))
+		if err := ioutil.WriteFile(path, []byte(file.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if file.old {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, err := pruneCacheDir(cacheDir, time.Now().Add(-24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		_, err := os.Stat(filepath.Join(cacheDir, filepath.FromSlash(file.name)))
+		if kept := err == nil; kept != file.kept {
+			t.Errorf("%s: kept = %v, want %v", file.name, kept, file.kept)
+		}
+	}
+}
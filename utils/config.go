@@ -34,9 +34,62 @@ type Configuration struct {
 	Description string
 	Authors     []string
 	License     string
+	Ignore      []string           `yaml:",omitempty"`
+	Tasks       map[string]Task    `yaml:",omitempty"`
+	Binaries    []Binary           `yaml:",omitempty"`
+	Profiles    map[string]Profile `yaml:",omitempty"`
 	Package     struct {
 		Include []string
+		Depends []string `yaml:",omitempty"`
 	}
+	Generate struct {
+		Enabled bool
+		Depends []string
+	} `yaml:",omitempty"`
+	Format struct {
+		Depends []string
+	} `yaml:",omitempty"`
+	Check struct {
+		Depends []string
+	} `yaml:",omitempty"`
+	Test struct {
+		Depends []string
+		Retries int `yaml:",omitempty"`
+	} `yaml:",omitempty"`
+	Bench struct {
+		Depends       []string
+		Count         int
+		Benchtime     string
+		Baseline      string
+		MaxRegression float64
+	} `yaml:",omitempty"`
+	Build struct {
+		Depends   []string
+		Platforms []string
+		Info      struct {
+			Disable   bool
+			Variables map[string]string
+			Package   string
+		} `yaml:",omitempty"`
+	} `yaml:",omitempty"`
+	Install struct {
+		Depends []string
+	} `yaml:",omitempty"`
+	Publish struct {
+		Depends []string
+	} `yaml:",omitempty"`
+	Size struct {
+		MaxGrowth string
+	} `yaml:",omitempty"`
+	Coverage struct {
+		MinTotal   float64
+		MinPackage float64
+	} `yaml:",omitempty"`
+	Cache struct {
+		Remote      string
+		ReadOnly    bool
+		LockTimeout string
+	} `yaml:",omitempty"`
 	Args struct {
 		Run string
 		Go  struct {
@@ -54,6 +107,48 @@ type Configuration struct {
 	}
 }
 
+// The Task struct describes a user defined task in the burrow.yaml. The commands of a task are run
+// one after another with the shell of the operating system inside the working directory (Dir) of the
+// task. Inputs and Outputs are file patterns (see MatchPattern) relative to the project root that are
+// used to cache the task. Tasks without inputs are run every time. Depends lists the actions and
+// tasks that have to run before the task.
+type Task struct {
+	Description string
+	Commands    []string
+	Inputs      []string
+	Outputs     []string
+	Env         map[string]string
+	Dir         string
+	Depends     []string
+}
+
+// The Binary struct describes an executable in the binaries list of the burrow.yaml. The Name is the
+// path of the binary inside of bin/, the Package is the main package (e.g. ./cmd/tool) or single go
+// file it is built from. Flags are passed to 'go build' in addition to the args.go.build and Tags
+// are the build tags of the binary.
+type Binary struct {
+	Name    string
+	Package string
+	Flags   string   `yaml:",omitempty"`
+	Tags    []string `yaml:",omitempty"`
+}
+
+// The Profile struct describes a named build profile in the burrow.yaml. The flags, tags, linker
+// flags (Ldflags) and compiler flags (Gcflags) are passed to 'go build' and 'go install' in addition
+// to the args.go.build, the Env is set for the go tool and Output is the directory the binaries are
+// built to instead of bin/. With Pgo, the default.pgo of a main package is passed to 'go build' as
+// profile for profile-guided optimization.
+type Profile struct {
+	Name    string            `yaml:"-"`
+	Flags   string            `yaml:",omitempty"`
+	Tags    []string          `yaml:",omitempty"`
+	Ldflags string            `yaml:",omitempty"`
+	Gcflags string            `yaml:",omitempty"`
+	Env     map[string]string `yaml:",omitempty"`
+	Output  string            `yaml:",omitempty"`
+	Pgo     bool              `yaml:",omitempty"`
+}
+
 // Config is the global instance of the Configuration struct and contains the parsed data of the
 // burrow.yaml.
 var Config Configuration = Configuration{}
@@ -0,0 +1,356 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The CoverageDir is the directory all coverage data and reports are written to. The profiles of
+// the tests and the coverage data of instrumented binaries are collected in its data directory.
+const CoverageDir = "coverage"
+
+// CoverageArgs returns the flags that make 'go test', 'go build' and 'go run' collect coverage of
+// all packages of the project. All profiles use the atomic mode, so they can be merged.
+func CoverageArgs() []string {
+	return []string{"-cover", "-covermode=atomic", "-coverpkg=./..."}
+}
+
+// The CoverBlock struct describes a block of statements in a coverage profile and how often it was
+// run.
+type CoverBlock struct {
+	File       string
+	StartLine  int
+	StartCol   int
+	EndLine    int
+	EndCol     int
+	Statements int
+	Count      int64
+}
+
+// key identifies the source range of the block.
+func (block CoverBlock) key() string {
+	return fmt.Sprintf("%s:%d.%d,%d.%d", block.File, block.StartLine, block.StartCol, block.EndLine, block.EndCol)
+}
+
+// The CoverProfile struct describes a coverage profile in the text format of 'go test -coverprofile'.
+type CoverProfile struct {
+	Mode   string
+	Blocks []CoverBlock
+}
+
+// The CoverageStats struct describes how many statements of a package or project are covered.
+type CoverageStats struct {
+	Statements int
+	Covered    int
+}
+
+// Percent returns the covered statements in percent. Without statements the coverage is 100%.
+func (stats CoverageStats) Percent() float64 {
+	if stats.Statements == 0 {
+		return 100
+	}
+	return float64(stats.Covered) * 100 / float64(stats.Statements)
+}
+
+// ReadCoverProfile reads a coverage profile in the text format.
+func ReadCoverProfile(file string) (CoverProfile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return CoverProfile{}, err
+	}
+	defer f.Close()
+
+	profile := CoverProfile{Blocks: []CoverBlock{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "mode: ") {
+			profile.Mode = strings.TrimPrefix(line, "mode: ")
+			continue
+		}
+
+		block := CoverBlock{}
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return CoverProfile{}, fmt.Errorf("invalid line in %s: %s", file, line)
+		}
+		block.File = line[:colon]
+		_, err := fmt.Sscanf(
+			line[colon+1:], "%d.%d,%d.%d %d %d",
+			&block.StartLine, &block.StartCol, &block.EndLine, &block.EndCol, &block.Statements, &block.Count,
+		)
+		if err != nil {
+			return CoverProfile{}, fmt.Errorf("invalid line in %s: %s", file, line)
+		}
+		profile.Blocks = append(profile.Blocks, block)
+	}
+	if err := scanner.Err(); err != nil {
+		return CoverProfile{}, err
+	}
+
+	// blocks of packages that are covered by multiple test binaries occur more than once
+	merged := CoverProfile{Mode: profile.Mode, Blocks: []CoverBlock{}}
+	merged.Merge(profile)
+	return merged, nil
+}
+
+// ReadCoverageData converts the coverage data that instrumented binaries wrote to the directory with
+// 'go tool covdata' and reads it as coverage profile.
+func ReadCoverageData(dir string) (CoverProfile, error) {
+	tmp, err := ioutil.TempFile("", "burrow-coverage-")
+	if err != nil {
+		return CoverProfile{}, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if _, err := ExecOutput("go", "tool", "covdata", "textfmt", "-i="+dir, "-o="+tmp.Name()); err != nil {
+		return CoverProfile{}, err
+	}
+	return ReadCoverProfile(tmp.Name())
+}
+
+// Merge adds the counts of another profile to the profile. Blocks of the same source range are
+// merged into one block.
+func (profile *CoverProfile) Merge(other CoverProfile) {
+	if profile.Mode == "" {
+		profile.Mode = other.Mode
+	}
+	index := map[string]int{}
+	for i, block := range profile.Blocks {
+		index[block.key()] = i
+	}
+	for _, block := range other.Blocks {
+		i, ok := index[block.key()]
+		if !ok {
+			index[block.key()] = len(profile.Blocks)
+			profile.Blocks = append(profile.Blocks, block)
+			continue
+		}
+		if profile.Mode == "set" {
+			if block.Count > 0 {
+				profile.Blocks[i].Count = 1
+			}
+		} else {
+			profile.Blocks[i].Count += block.Count
+		}
+	}
+}
+
+// Write writes the profile in the text format.
+func (profile CoverProfile) Write(file string) error {
+	blocks := append([]CoverBlock{}, profile.Blocks...)
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].File != blocks[j].File {
+			return blocks[i].File < blocks[j].File
+		}
+		if blocks[i].StartLine != blocks[j].StartLine {
+			return blocks[i].StartLine < blocks[j].StartLine
+		}
+		return blocks[i].StartCol < blocks[j].StartCol
+	})
+
+	return WriteFileAtomic(file, 0644, func(w io.Writer) error {
+		if _, err := fmt.Fprintf(w, "mode: %s\n", profile.Mode); err != nil {
+			return err
+		}
+		for _, block := range blocks {
+			_, err := fmt.Fprintf(w, "%s %d %d\n", block.key(), block.Statements, block.Count)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Packages returns the coverage of every package in the profile by import path.
+func (profile CoverProfile) Packages() map[string]CoverageStats {
+	packages := map[string]CoverageStats{}
+	for _, block := range profile.Blocks {
+		pkg := path.Dir(block.File)
+		stats := packages[pkg]
+		stats.Statements += block.Statements
+		if block.Count > 0 {
+			stats.Covered += block.Statements
+		}
+		packages[pkg] = stats
+	}
+	return packages
+}
+
+// Total returns the coverage of all packages in the profile.
+func (profile CoverProfile) Total() CoverageStats {
+	total := CoverageStats{}
+	for _, stats := range profile.Packages() {
+		total.Statements += stats.Statements
+		total.Covered += stats.Covered
+	}
+	return total
+}
+
+// The coberturaCoverage struct describes the root element of a Cobertura XML report.
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+// The coberturaPackage struct describes a go package in a Cobertura XML report.
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity int              `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+// The coberturaClass struct describes a go file in a Cobertura XML report.
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity int             `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+// The coberturaLine struct describes how often a line of a go file was run.
+type coberturaLine struct {
+	Number int   `xml:"number,attr"`
+	Hits   int64 `xml:"hits,attr"`
+}
+
+// WriteCobertura writes the profile as Cobertura XML report. The files of the profile are reported
+// relative to the root directory of the module (source).
+func (profile CoverProfile) WriteCobertura(file string, source string, module string) error {
+	lines := map[string]map[string]map[int]int64{}
+	for _, block := range profile.Blocks {
+		pkg := path.Dir(block.File)
+		if lines[pkg] == nil {
+			lines[pkg] = map[string]map[int]int64{}
+		}
+		if lines[pkg][block.File] == nil {
+			lines[pkg][block.File] = map[int]int64{}
+		}
+		for line := block.StartLine; line <= block.EndLine; line++ {
+			if hits, ok := lines[pkg][block.File][line]; !ok || block.Count > hits {
+				lines[pkg][block.File][line] = block.Count
+			}
+		}
+	}
+
+	report := coberturaCoverage{
+		Version:   GetGoEnv()["GOVERSION"],
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Sources:   []string{filepath.ToSlash(source)},
+	}
+	pkgs := []string{}
+	for pkg := range lines {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		reportPkg := coberturaPackage{Name: pkg}
+		pkgValid, pkgCovered := 0, 0
+		files := []string{}
+		for name := range lines[pkg] {
+			files = append(files, name)
+		}
+		sort.Strings(files)
+		for _, name := range files {
+			class := coberturaClass{
+				Name:     path.Base(name),
+				Filename: strings.TrimPrefix(strings.TrimPrefix(name, module), "/"),
+			}
+			covered := 0
+			numbers := []int{}
+			for number := range lines[pkg][name] {
+				numbers = append(numbers, number)
+			}
+			sort.Ints(numbers)
+			for _, number := range numbers {
+				hits := lines[pkg][name][number]
+				class.Lines = append(class.Lines, coberturaLine{Number: number, Hits: hits})
+				if hits > 0 {
+					covered++
+				}
+			}
+			class.LineRate = coberturaRate(covered, len(numbers))
+			class.BranchRate = "0"
+			reportPkg.Classes = append(reportPkg.Classes, class)
+			pkgValid += len(numbers)
+			pkgCovered += covered
+		}
+		reportPkg.LineRate = coberturaRate(pkgCovered, pkgValid)
+		reportPkg.BranchRate = "0"
+		report.Packages = append(report.Packages, reportPkg)
+		report.LinesValid += pkgValid
+		report.LinesCovered += pkgCovered
+	}
+	report.LineRate = coberturaRate(report.LinesCovered, report.LinesValid)
+	report.BranchRate = "0"
+
+	return WriteFileAtomic(file, 0644, func(w io.Writer) error {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+}
+
+// coberturaRate formats the ratio of covered to valid lines for a Cobertura XML report.
+func coberturaRate(covered int, valid int) string {
+	if valid == 0 {
+		return "1"
+	}
+	return strconv.FormatFloat(float64(covered)/float64(valid), 'f', 4, 64)
+}
@@ -0,0 +1,85 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoverProfileMerge(t *testing.T) {
+	block := func(startLine int, endLine int, statements int, count int64) CoverBlock {
+		return CoverBlock{File: "example.com/p/p.go", StartLine: startLine, StartCol: 1, EndLine: endLine,
+			EndCol: 2, Statements: statements, Count: count}
+	}
+	tests := []struct {
+		name    string
+		profile CoverProfile
+		other   CoverProfile
+		merged  CoverProfile
+	}{
+		{
+			"empty profile takes the mode",
+			CoverProfile{},
+			CoverProfile{Mode: "count", Blocks: []CoverBlock{block(1, 3, 2, 1)}},
+			CoverProfile{Mode: "count", Blocks: []CoverBlock{block(1, 3, 2, 1)}},
+		},
+		{
+			"same range adds the counts",
+			CoverProfile{Mode: "count", Blocks: []CoverBlock{block(1, 3, 2, 1), block(4, 5, 1, 0)}},
+			CoverProfile{Mode: "count", Blocks: []CoverBlock{block(1, 3, 2, 2), block(4, 5, 1, 3)}},
+			CoverProfile{Mode: "count", Blocks: []CoverBlock{block(1, 3, 2, 3), block(4, 5, 1, 3)}},
+		},
+		{
+			"set mode only records whether a block ran",
+			CoverProfile{Mode: "set", Blocks: []CoverBlock{block(1, 3, 2, 0), block(4, 5, 1, 1)}},
+			CoverProfile{Mode: "set", Blocks: []CoverBlock{block(1, 3, 2, 1), block(4, 5, 1, 1)}},
+			CoverProfile{Mode: "set", Blocks: []CoverBlock{block(1, 3, 2, 1), block(4, 5, 1, 1)}},
+		},
+		{
+			"set mode keeps covered blocks",
+			CoverProfile{Mode: "set", Blocks: []CoverBlock{block(1, 3, 2, 1)}},
+			CoverProfile{Mode: "set", Blocks: []CoverBlock{block(1, 3, 2, 0)}},
+			CoverProfile{Mode: "set", Blocks: []CoverBlock{block(1, 3, 2, 1)}},
+		},
+		{
+			"overlapping ranges are different blocks",
+			CoverProfile{Mode: "atomic", Blocks: []CoverBlock{block(1, 5, 3, 1)}},
+			CoverProfile{Mode: "atomic", Blocks: []CoverBlock{block(2, 5, 2, 4), block(1, 5, 3, 1)}},
+			CoverProfile{Mode: "atomic", Blocks: []CoverBlock{block(1, 5, 3, 2), block(2, 5, 2, 4)}},
+		},
+		{
+			"other files are added",
+			CoverProfile{Mode: "count", Blocks: []CoverBlock{block(1, 3, 2, 1)}},
+			CoverProfile{Mode: "count", Blocks: []CoverBlock{{File: "example.com/q/q.go", StartLine: 1, StartCol: 1,
+				EndLine: 3, EndCol: 2, Statements: 2, Count: 5}}},
+			CoverProfile{Mode: "count", Blocks: []CoverBlock{block(1, 3, 2, 1), {File: "example.com/q/q.go",
+				StartLine: 1, StartCol: 1, EndLine: 3, EndCol: 2, Statements: 2, Count: 5}}},
+		},
+	}
+	for _, test := range tests {
+		profile := test.profile
+		profile.Blocks = append([]CoverBlock{}, test.profile.Blocks...)
+		profile.Merge(test.other)
+		if !reflect.DeepEqual(profile, test.merged) {
+			t.Errorf("%s: merged profile is %+v, want %+v", test.name, profile, test.merged)
+		}
+	}
+}
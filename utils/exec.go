@@ -20,11 +20,15 @@
 package burrow
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/urfave/cli"
 )
@@ -42,7 +46,27 @@ func Exec(target string, comm string, args ...string) error {
 // target (tag/name). When the target is "" (empty string) stdout and stderr of the command
 // will be directly mapped to the stdout and stderr of the application.
 func ExecDir(target string, dir string, comm string, args ...string) error {
-	cmd := exec.Command(comm, args...)
+	return ExecEnv(target, dir, nil, comm, args...)
+}
+
+// ExecEnv runs a given command (comm) with arguments (args) like ExecDir. The env parameter
+// contains additional environment variables in the form "key=value" that override the environment
+// of burrow for the command.
+func ExecEnv(target string, dir string, env []string, comm string, args ...string) error {
+	return ExecContext(context.Background(), target, dir, env, comm, args...)
+}
+
+// ExecContext runs a given command (comm) with arguments (args) like ExecEnv. The command is killed
+// when the context (ctx) is cancelled, in which case the error of the context is returned.
+func ExecContext(ctx context.Context, target string, dir string, env []string, comm string, args ...string) error {
+	return ExecWriter(ctx, target, dir, env, nil, comm, args...)
+}
+
+// ExecWriter runs a given command (comm) with arguments (args) like ExecContext, but writes the
+// stdout of the command to the given writer (stdout) instead of the logger. A nil writer is the
+// same as ExecContext.
+func ExecWriter(ctx context.Context, target string, dir string, env []string, stdout io.Writer, comm string, args ...string) error {
+	cmd := exec.CommandContext(ctx, comm, args...)
 	cmd.Stdin = os.Stdin
 
 	dir, err := filepath.EvalSymlinks(dir)
@@ -50,14 +74,15 @@ func ExecDir(target string, dir string, comm string, args ...string) error {
 		return err
 	}
 	cmd.Dir = dir
-	env := os.Environ()
-	cmd.Env = make([]string, len(env))
-	for _, val := range os.Environ() {
+	environ := os.Environ()
+	cmd.Env = make([]string, 0, len(environ)+len(env))
+	for _, val := range environ {
 		if strings.HasPrefix(val, "PWD=") {
 			val = fmt.Sprintf("PWD=%s", dir)
 		}
 		cmd.Env = append(cmd.Env, val)
 	}
+	cmd.Env = append(cmd.Env, env...)
 
 	if target == "" {
 		cmd.Stdout = os.Stdout
@@ -66,10 +91,99 @@ func ExecDir(target string, dir string, comm string, args ...string) error {
 		cmd.Stdout = NewLogger(target, LOG_INFO)
 		cmd.Stderr = NewLogger(target, LOG_WARN)
 	}
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
 
 	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		Log(LOG_ERR, target, "Error running action: %v", err)
 		return cli.NewExitError("", EXIT_ACTION)
 	}
 	return nil
 }
+
+// The Job struct describes a command that is run by RunJobs. See ExecEnv for the meaning of the
+// fields.
+type Job struct {
+	Target string
+	Dir    string
+	Env    []string
+	Comm   string
+	Args   []string
+}
+
+// RunJobs runs the given jobs with at most n jobs running at the same time. After the first failing
+// job no further jobs are started and all running jobs are cancelled. The error of the first
+// failing job is returned.
+func RunJobs(n int, jobs []Job) error {
+	if n < 1 {
+		n = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mutex sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, n)
+	for _, job := range jobs {
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			err := ExecContext(ctx, job.Target, job.Dir, job.Env, job.Comm, job.Args...)
+			if err != nil && err != context.Canceled {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mutex.Unlock()
+			}
+		}(job)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// ExecShell runs a command line with the shell of the operating system (sh on unix systems, cmd on
+// windows) like ExecEnv. On unix systems the args are passed as positional parameters to the shell,
+// so the command line can refer to them with "$@".
+func ExecShell(target string, dir string, env []string, command string, args ...string) error {
+	if runtime.GOOS == "windows" {
+		return ExecEnv(target, dir, env, "cmd", "/C", command)
+	}
+	return ExecEnv(target, dir, env, "sh", append([]string{"-c", command, "burrow"}, args...)...)
+}
+
+// ExecOutput runs a given command (comm) with arguments (args) and returns everything the command
+// wrote to stdout. The stderr output of the command is part of the returned error on failure.
+func ExecOutput(comm string, args ...string) ([]byte, error) {
+	return ExecOutputEnv(nil, comm, args...)
+}
+
+// ExecOutputEnv runs a command with additional environment variables and returns its standard
+// output.
+func ExecOutputEnv(env []string, comm string, args ...string) ([]byte, error) {
+	cmd := exec.Command(comm, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	stderr := &strings.Builder{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v: %s", comm, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
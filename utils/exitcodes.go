@@ -29,4 +29,7 @@ const (
 
 	// Burrow encountered an error while running the specified action.
 	EXIT_ACTION
+
+	// Burrow could not acquire the lock of the current project.
+	EXIT_LOCK
 )
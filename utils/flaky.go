@@ -0,0 +1,113 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The flakyHistoryFile is the file the history of flaky tests of the project is stored in.
+var flakyHistoryFile = filepath.Join(".burrow", "flaky.json")
+
+// The FlakyTest struct describes how often a test was flaky, i.e. passed after it was retried, and
+// how often it failed even after all retries.
+type FlakyTest struct {
+	Package   string    `json:"package"`
+	Test      string    `json:"test"`
+	Flakes    int       `json:"flakes"`
+	Failures  int       `json:"failures"`
+	LastFlake time.Time `json:"lastFlake"`
+}
+
+// The FlakyHistory struct describes the layout of the file the flaky tests are recorded in.
+type FlakyHistory struct {
+	Tests []FlakyTest `json:"tests"`
+}
+
+// ReadFlakyHistory reads the history of flaky tests of the project. A missing file is an empty
+// history.
+func ReadFlakyHistory() (FlakyHistory, error) {
+	history := FlakyHistory{Tests: []FlakyTest{}}
+	data, err := ioutil.ReadFile(flakyHistoryFile)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return history, err
+	}
+	err = json.Unmarshal(data, &history)
+	return history, err
+}
+
+// test returns the record of a test, which is added to the history if necessary.
+func (history *FlakyHistory) test(pkg string, test string) *FlakyTest {
+	for i := range history.Tests {
+		if history.Tests[i].Package == pkg && history.Tests[i].Test == test {
+			return &history.Tests[i]
+		}
+	}
+	history.Tests = append(history.Tests, FlakyTest{Package: pkg, Test: test})
+	return &history.Tests[len(history.Tests)-1]
+}
+
+// Record adds the retried tests of a test result to the history. Flaky tests count as flake, tests
+// that failed after all retries as failure.
+func (history *FlakyHistory) Record(result PackageResult, now time.Time) {
+	for _, test := range result.Tests {
+		switch {
+		case test.Flaky:
+			record := history.test(result.Name, test.Name)
+			record.Flakes++
+			record.LastFlake = now
+		case test.Retries > 0 && test.Status == "fail":
+			history.test(result.Name, test.Name).Failures++
+		}
+	}
+}
+
+// Sorted returns the tests of the history with the most flakes first.
+func (history FlakyHistory) Sorted() []FlakyTest {
+	tests := append([]FlakyTest{}, history.Tests...)
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].Flakes != tests[j].Flakes {
+			return tests[i].Flakes > tests[j].Flakes
+		}
+		if !tests[i].LastFlake.Equal(tests[j].LastFlake) {
+			return tests[i].LastFlake.After(tests[j].LastFlake)
+		}
+		return tests[i].Package+"."+tests[i].Test < tests[j].Package+"."+tests[j].Test
+	})
+	return tests
+}
+
+// Write stores the history of flaky tests.
+func (history FlakyHistory) Write() error {
+	return WriteFileAtomic(flakyHistoryFile, 0644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(history)
+	})
+}
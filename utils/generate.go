@@ -0,0 +1,158 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// The generatedHeader matches the comment that marks a go file as generated, see
+// https://golang.org/s/generatedcode.
+var generatedHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// The GenerateDirective struct describes a //go:generate line of a go file. Commands defined with
+// -command in the same file are already expanded in the Args.
+type GenerateDirective struct {
+	File string
+	Line int
+	Args []string
+}
+
+// GetGenerateDirectives returns the //go:generate directives of the given go files in the order
+// 'go generate' runs them.
+func GetGenerateDirectives(files []string) ([]GenerateDirective, error) {
+	directives := []GenerateDirective{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+
+		commands := map[string][]string{}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimRight(scanner.Text(), " \t\r")
+			if !strings.HasPrefix(text, "//go:generate ") && !strings.HasPrefix(text, "//go:generate\t") {
+				continue
+			}
+			args, err := shellwords.Parse(text[len("//go:generate "):])
+			if err != nil || len(args) == 0 {
+				continue
+			}
+			if args[0] == "-command" {
+				if len(args) > 2 {
+					commands[args[1]] = args[2:]
+				}
+				continue
+			}
+			if command, ok := commands[args[0]]; ok {
+				args = append(append([]string{}, command...), args[1:]...)
+			}
+			directives = append(directives, GenerateDirective{File: file, Line: line, Args: args})
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return directives, nil
+}
+
+// IsGeneratedFile checks whether a go file starts with a "Code generated ... DO NOT EDIT." comment.
+// Files that are not go files are never generated.
+func IsGeneratedFile(file string) bool {
+	if filepath.Ext(file) != ".go" {
+		return false
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if generatedHeader.MatchString(line) {
+			return true
+		}
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+	}
+	return false
+}
+
+// GeneratorKey identifies the generator program of a directive for the cache key of its package.
+// Programs found in the PATH are identified by their digest, so installing a new version of a
+// generator runs it again. Generators run with the go tool are covered by the go environment and
+// the GeneratorInputs instead.
+func (directive GenerateDirective) GeneratorKey() string {
+	name := directive.Args[0]
+	if name == "go" {
+		return "go"
+	}
+	program, err := exec.LookPath(name)
+	if err != nil {
+		return name + " missing"
+	}
+	hash, err := HashFile(program)
+	if err != nil {
+		return name + " unreadable"
+	}
+	return name + " " + hash
+}
+
+// GeneratorInputs returns the files of the project a directive in the package directory dir runs,
+// i.e. the local packages run with 'go run' and the go.mod and go.sum for 'go run' and 'go tool'.
+func (directive GenerateDirective) GeneratorInputs(target string, dir string) []string {
+	args := directive.Args
+	if len(args) < 2 || args[0] != "go" {
+		return []string{}
+	}
+	switch args[1] {
+	case "run":
+		for _, arg := range args[2:] {
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+			if strings.Contains(arg, "@") {
+				break
+			}
+			if strings.HasPrefix(arg, ".") || strings.HasSuffix(arg, ".go") {
+				arg = "./" + filepath.ToSlash(filepath.Join(dir, arg))
+			}
+			return GetPackageInputs(target, nil, false, arg)
+		}
+	case "tool":
+	default:
+		return []string{}
+	}
+	return GetModuleFiles()
+}
@@ -0,0 +1,118 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetGenerateDirectives(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name       string
+		content    string
+		directives [][]string
+	}{
+		{"no directives", "package main\n", [][]string{}},
+		{"single directive", "package main\n\n//go:generate stringer -type=Color\n", [][]string{{"stringer", "-type=Color"}}},
+		{"tab separated", "package main\n//go:generate\tprotoc --go_out=. api.proto\n", [][]string{{"protoc", "--go_out=.", "api.proto"}}},
+		{"quoted arguments", "package main\n//go:generate sh -c \"echo a b\"\n", [][]string{{"sh", "-c", "echo a b"}}},
+		{"trailing whitespace", "package main\n//go:generate go run gen.go \r\n", [][]string{{"go", "run", "gen.go"}}},
+		{"in order", "//go:generate first\npackage main\n//go:generate second\n", [][]string{{"first"}, {"second"}}},
+		{"command alias", "package main\n//go:generate -command yacc go tool yacc\n//go:generate yacc -o expr.go expr.y\n", [][]string{{"go", "tool", "yacc", "-o", "expr.go", "expr.y"}}},
+		{"alias used before definition", "package main\n//go:generate yacc expr.y\n//go:generate -command yacc go tool yacc\n", [][]string{{"yacc", "expr.y"}}},
+		{"not a directive", "package main\n // go:generate a\n//go:generateb\n// //go:generate c\n\t//go:generate d\n", [][]string{}},
+		{"empty directive", "package main\n//go:generate \n", [][]string{}},
+	}
+	for i, test := range tests {
+		file := filepath.Join(dir, string(rune('a'+i))+".go")
+		if err := ioutil.WriteFile(file, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		directives, err := GetGenerateDirectives([]string{file})
+		if err != nil {
+			t.Errorf("%s: GetGenerateDirectives failed: %s", test.name, err)
+			continue
+		}
+		args := [][]string{}
+		for _, directive := range directives {
+			if directive.File != file {
+				t.Errorf("%s: directive of file %s, want %s", test.name, directive.File, file)
+			}
+			args = append(args, directive.Args)
+		}
+		if !reflect.DeepEqual(args, test.directives) {
+			t.Errorf("%s: GetGenerateDirectives = %q, want %q", test.name, args, test.directives)
+		}
+	}
+
+	first := filepath.Join(dir, "first.go")
+	second := filepath.Join(dir, "second.go")
+	if err := ioutil.WriteFile(first, []byte("package main\n//go:generate -command gen echo\n\n//go:generate gen one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(second, []byte("package main\n//go:generate gen two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	directives, err := GetGenerateDirectives([]string{first, second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []GenerateDirective{
+		{File: first, Line: 4, Args: []string{"echo", "one"}},
+		{File: second, Line: 2, Args: []string{"gen", "two"}},
+	}
+	if !reflect.DeepEqual(directives, expected) {
+		t.Errorf("GetGenerateDirectives = %+v, want %+v", directives, expected)
+	}
+
+	if _, err := GetGenerateDirectives([]string{filepath.Join(dir, "missing.go")}); err == nil {
+		t.Errorf("GetGenerateDirectives of a missing file succeeded")
+	}
+}
+
+func TestIsGeneratedFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		generated bool
+	}{
+		{"generated", "a.go", "// Code generated by stringer; DO NOT EDIT.\n\npackage main\n", true},
+		{"after the license", "b.go", "// Copyright\n\n// Code generated by protoc-gen-go. DO NOT EDIT.\npackage api\n", true},
+		{"after the package clause", "c.go", "package main\n// Code generated by hand. DO NOT EDIT.\n", false},
+		{"handwritten", "d.go", "package main\n", false},
+		{"missing period", "e.go", "// Code generated by stringer; DO NOT EDIT\npackage main\n", false},
+		{"not a go file", "f.txt", "// Code generated by stringer; DO NOT EDIT.\n", false},
+	}
+	for _, test := range tests {
+		file := filepath.Join(dir, test.file)
+		if err := ioutil.WriteFile(file, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if generated := IsGeneratedFile(file); generated != test.generated {
+			t.Errorf("%s: IsGeneratedFile = %v, want %v", test.name, generated, test.generated)
+		}
+	}
+}
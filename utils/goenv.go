@@ -0,0 +1,67 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// The goEnvVars are the 'go env' variables that influence the result of an action and are therefore
+// part of the cache key of every target.
+var goEnvVars = []string{
+	"GOVERSION", "GOOS", "GOARCH", "GOAMD64", "GOARM", "GOARM64", "GO386", "GOMIPS", "GOMIPS64",
+	"GOPPC64", "GORISCV64", "GOWASM", "GOEXPERIMENT", "GOFLAGS", "CGO_ENABLED", "CC", "CXX",
+	"CGO_CFLAGS", "CGO_CPPFLAGS", "CGO_CXXFLAGS", "CGO_LDFLAGS",
+}
+
+// The goEnvs map caches the output of 'go env' for every set of environment overrides, as it does
+// not change during a run of burrow.
+var goEnvs = map[string]map[string]string{}
+var goEnvMutex sync.Mutex
+
+// GetGoEnv returns the values of all 'go env' variables that influence the result of an action.
+func GetGoEnv() map[string]string {
+	return GetGoEnvFor(nil)
+}
+
+// GetGoEnvFor returns the values of all 'go env' variables that influence the result of an action
+// when it is run with the given additional environment variables (e.g. GOOS=windows).
+func GetGoEnvFor(env []string) map[string]string {
+	key := strings.Join(env, "\n")
+	goEnvMutex.Lock()
+	defer goEnvMutex.Unlock()
+	if values, ok := goEnvs[key]; ok {
+		return values
+	}
+
+	values := map[string]string{}
+	goEnvs[key] = values
+	out, err := ExecOutputEnv(env, "go", append([]string{"env", "-json"}, goEnvVars...)...)
+	if err != nil {
+		Log(LOG_WARN, "burrow", "Failed to read go environment: %s", err)
+		return values
+	}
+	if err := json.Unmarshal(out, &values); err != nil {
+		Log(LOG_WARN, "burrow", "Failed to read go environment: %s", err)
+	}
+	return values
+}
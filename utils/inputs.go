@@ -0,0 +1,317 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The defaultIgnores are ignore patterns that are always applied in addition to the ignore patterns
+// of the burrow.yaml.
+var defaultIgnores = []string{".git", "vendor", "/bin", "/package", "/.burrow", "/coverage"}
+
+// The ListedPackage struct describes the subset of the 'go list -json' output burrow is interested
+// in.
+type ListedPackage struct {
+	Dir             string
+	ImportPath      string
+	Name            string
+	ForTest         string
+	GoFiles         []string
+	CgoFiles        []string
+	CFiles          []string
+	CXXFiles        []string
+	MFiles          []string
+	HFiles          []string
+	FFiles          []string
+	SFiles          []string
+	SwigFiles       []string
+	SwigCXXFiles    []string
+	SysoFiles       []string
+	EmbedFiles      []string
+	TestGoFiles     []string
+	XTestGoFiles    []string
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+	Imports         []string
+	Deps            []string
+	Module          *struct {
+		Path    string
+		Main    bool
+		Replace *struct {
+			Dir     string
+			Version string
+		}
+	}
+}
+
+// IsLocal returns whether the package is part of the current project or of a module that is
+// replaced by a local directory. Only files of local packages are tracked as inputs, all other
+// packages are pinned by the go.sum.
+func (pkg ListedPackage) IsLocal() bool {
+	if pkg.Module == nil {
+		return false
+	}
+	return pkg.Module.Main || (pkg.Module.Replace != nil && pkg.Module.Replace.Version == "")
+}
+
+// Files returns the paths of all files of the package that are relevant for a build. If tests is
+// set, the test files of the package are returned as well.
+func (pkg ListedPackage) Files(tests bool) []string {
+	groups := [][]string{
+		pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.MFiles, pkg.HFiles, pkg.FFiles,
+		pkg.SFiles, pkg.SwigFiles, pkg.SwigCXXFiles, pkg.SysoFiles, pkg.EmbedFiles,
+	}
+	if tests {
+		groups = append(groups, pkg.TestGoFiles, pkg.XTestGoFiles, pkg.TestEmbedFiles, pkg.XTestEmbedFiles)
+	}
+
+	files := []string{}
+	for _, group := range groups {
+		for _, file := range group {
+			// synthesized files (e.g. the test main) live in the go build cache
+			if filepath.IsAbs(file) {
+				continue
+			}
+			files = append(files, filepath.Join(pkg.Dir, file))
+		}
+	}
+	return files
+}
+
+// TestdataFiles returns the paths of all files in the testdata directory of the package, e.g. golden
+// files, which are read by the tests of the package.
+func (pkg ListedPackage) TestdataFiles() []string {
+	files := []string{}
+	_ = filepath.Walk(filepath.Join(pkg.Dir, "testdata"), func(file string, f os.FileInfo, err error) error {
+		if err == nil && !f.IsDir() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files
+}
+
+// ListPackages runs 'go list -json' with the given arguments and additional environment variables
+// (env) and returns the decoded packages.
+func ListPackages(env []string, args ...string) ([]ListedPackage, error) {
+	out, err := ExecOutputEnv(env, "go", append([]string{"list", "-e", "-json"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := []ListedPackage{}
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	for {
+		pkg := ListedPackage{}
+		err := decoder.Decode(&pkg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// GetPackageInputs returns the paths of all files the given packages (patterns) are built from. This
+// includes the files of every local dependency as well as the go.mod and go.sum of the project. If
+// tests is set, the test files and testdata of the packages and their dependencies are included too.
+// When the packages cannot be listed all code files of the project are returned instead. The env
+// contains additional environment variables like GOOS that select the files of the packages.
+func GetPackageInputs(target string, env []string, tests bool, patterns ...string) []string {
+	args := []string{"-deps"}
+	if tests {
+		args = append(args, "-test")
+	}
+	args = append(args, patterns...)
+
+	packages, err := ListPackages(env, args...)
+	if err != nil {
+		Log(LOG_WARN, target, "Failed to list packages, using all code files as inputs: %s", err)
+		return append(GetCodefiles(), GetModuleFiles()...)
+	}
+
+	wd, _ := os.Getwd()
+	inputs := map[string]bool{}
+	for _, pkg := range packages {
+		if !pkg.IsLocal() {
+			continue
+		}
+		files := pkg.Files(tests)
+		if tests {
+			files = append(files, pkg.TestdataFiles()...)
+		}
+		for _, file := range files {
+			if rel, err := filepath.Rel(wd, file); err == nil {
+				file = rel
+			}
+			if !IsIgnored(file) {
+				inputs[file] = true
+			}
+		}
+	}
+	for _, file := range GetModuleFiles() {
+		inputs[file] = true
+	}
+
+	files := make([]string, 0, len(inputs))
+	for file := range inputs {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// ExpandPatterns returns the paths of all files in the project matching one of the given patterns
+// (see MatchPattern). Patterns that do not contain any wildcards are paths of files and skipped if
+// there is no such file.
+func ExpandPatterns(patterns []string) []string {
+	return expandPatterns(patterns, false)
+}
+
+// ExpandOutputPatterns works like ExpandPatterns, but returns the patterns that do not contain any
+// wildcards as they are, even if there is no such file, since outputs may not have been created yet.
+func ExpandOutputPatterns(patterns []string) []string {
+	return expandPatterns(patterns, true)
+}
+
+// expandPatterns returns the paths of all files matching one of the patterns. If keepMissing is set,
+// paths without wildcards are returned even if there is no such file.
+func expandPatterns(patterns []string, keepMissing bool) []string {
+	files := map[string]bool{}
+	globs := []string{}
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			globs = append(globs, pattern)
+			continue
+		}
+		file := filepath.Clean(pattern)
+		if f, err := os.Stat(file); keepMissing || (err == nil && !f.IsDir()) {
+			files[file] = true
+		}
+	}
+
+	if len(globs) > 0 {
+		_ = filepath.Walk(".", func(file string, f os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if f.IsDir() {
+				if f.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			for _, pattern := range globs {
+				if MatchPattern(pattern, filepath.ToSlash(file)) {
+					files[file] = true
+					break
+				}
+			}
+			return nil
+		})
+	}
+
+	paths := make([]string, 0, len(files))
+	for file := range files {
+		paths = append(paths, file)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// GetModuleFiles returns the paths of the go.mod and go.sum files of the project if they exist.
+func GetModuleFiles() []string {
+	files := []string{}
+	for _, file := range []string{"go.mod", "go.sum"} {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// IsIgnored checks whether a path relative to the project root matches one of the ignore patterns of
+// the project. A path is also ignored if one of its parent directories is ignored.
+func IsIgnored(file string) bool {
+	file = filepath.ToSlash(filepath.Clean(file))
+	if file == "." || strings.HasPrefix(file, "../") {
+		return false
+	}
+
+	patterns := append(append([]string{}, defaultIgnores...), Config.Ignore...)
+	for dir := file; dir != "."; dir = path.Dir(dir) {
+		for _, pattern := range patterns {
+			if MatchPattern(pattern, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchPattern checks whether a slash separated path relative to the project root matches a
+// pattern. Patterns follow the syntax of path.Match with the addition of '**', which matches any
+// number of directories. Like in .gitignore files a pattern that does not contain a slash (except
+// for a trailing one) matches at any depth, while all other patterns are anchored at the project
+// root.
+func MatchPattern(pattern string, file string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		pattern = "**/" + pattern
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+// matchSegments matches the segments of a path against the segments of a pattern.
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,59 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		match   bool
+	}{
+		{"vendor", "vendor", true},
+		{"vendor", "lib/vendor", true},
+		{"vendor/", "lib/vendor", true},
+		{"vendor", "vendors", false},
+		{"/bin", "bin", true},
+		{"/bin", "cmd/bin", false},
+		{"*.pb.go", "proto/api/service.pb.go", true},
+		{"*.pb.go", "service.go", false},
+		{"proto/*.proto", "proto/api.proto", true},
+		{"proto/*.proto", "proto/v1/api.proto", false},
+		{"proto/**/*.proto", "proto/api.proto", true},
+		{"proto/**/*.proto", "proto/v1/beta/api.proto", true},
+		{"proto/**/*.proto", "other/proto/api.proto", false},
+		{"**/gen", "gen", true},
+		{"**/gen", "a/b/gen", true},
+		{"docs/**", "docs/a/b.md", true},
+		{"docs/**", "docs", true},
+		{"a/**/b/**/c", "a/x/b/y/z/c", true},
+		{"a/**/b/**/c", "a/x/y/c", false},
+		{"file?.txt", "file1.txt", true},
+		{"file[0-9].txt", "filex.txt", false},
+	}
+	for _, test := range tests {
+		if match := MatchPattern(test.pattern, test.file); match != test.match {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", test.pattern, test.file, match, test.match)
+		}
+	}
+}
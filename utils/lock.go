@@ -0,0 +1,184 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The defaultLockTimeout is used when no lock timeout is configured in the burrow.yaml.
+const defaultLockTimeout = 5 * time.Minute
+
+// The lockPollInterval describes how often burrow checks whether a lock has been released.
+const lockPollInterval = 100 * time.Millisecond
+
+var lockMutex sync.Mutex
+var lockFile *os.File
+
+// LockProject acquires an advisory lock for the current project, which prevents multiple burrow
+// processes from running targets of the same project at the same time. The lock is held until
+// UnlockProject is called, calling LockProject again while holding the lock has no effect. If the
+// lock is held by another process, LockProject waits until it is released or the lock timeout of
+// the project has passed.
+func LockProject() error {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+
+	if lockFile != nil {
+		return nil
+	}
+
+	cacheDir, err := GetCacheDir()
+	if err != nil {
+		return err
+	}
+
+	timeout := defaultLockTimeout
+	if Config.Cache.LockTimeout != "" {
+		if timeout, err = ParseAge(Config.Cache.LockTimeout); err != nil {
+			return fmt.Errorf("invalid lock timeout: %v", err)
+		}
+	}
+
+	lockFile, err = lockCacheDir(cacheDir, timeout)
+	return err
+}
+
+// UnlockProject releases the project lock if it is held by this process.
+func UnlockProject() {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+
+	if lockFile == nil {
+		return
+	}
+	unlockCacheDir(lockFile)
+	lockFile = nil
+}
+
+// lockCacheDir acquires the lock of a cache directory and returns the open lock file. If the lock
+// is held by another process, lockCacheDir waits until it is released or the timeout has passed.
+// The lock is a lock of the operating system on the lock file, so it is released when the process
+// holding it exits, even if it crashed.
+func lockCacheDir(cacheDir string, timeout time.Duration) (*os.File, error) {
+	path := filepath.Join(cacheDir, "lock")
+	deadline := time.Now().Add(timeout)
+	var file *os.File
+	for file == nil {
+		locked, err := waitForLock(path, deadline, timeout)
+		if err != nil {
+			return nil, err
+		}
+		// a prune removes the cache directory of a deleted project while holding its lock, then the
+		// locked file is not the lock file of the directory anymore and has to be created again
+		if isSameFile(locked, path) {
+			file = locked
+		} else {
+			unlockFile(locked)
+			locked.Close()
+		}
+	}
+
+	err := file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+	if err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// isSameFile checks whether the open file is the file at path.
+func isSameFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	return err == nil && os.SameFile(opened, current)
+}
+
+// waitForLock opens the lock file at path and waits until it is locked or the deadline has passed.
+func waitForLock(path string, deadline time.Time, timeout time.Duration) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	waitingFor := -1
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if locked {
+			return file, nil
+		}
+
+		// the lock file contains the pid of the process holding the lock, see lockCacheDir
+		pid, err := readLockOwner(path)
+		if err != nil {
+			pid = 0
+		}
+		if pid != waitingFor {
+			if pid > 0 {
+				Log(LOG_INFO, "burrow", "Waiting for lock held by pid %d...", pid)
+			} else {
+				Log(LOG_INFO, "burrow", "Waiting for lock of %s...", path)
+			}
+			waitingFor = pid
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("timed out after %s waiting for lock held by pid %d (%s)", timeout, pid, path)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// unlockCacheDir releases the lock of a cache directory acquired by lockCacheDir.
+func unlockCacheDir(file *os.File) {
+	file.Truncate(0)
+	unlockFile(file)
+	file.Close()
+}
+
+// readLockOwner returns the pid of the process holding the lock file at the given path.
+func readLockOwner(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,116 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLockCacheDir(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "project")
+	lock, err := lockCacheDir(cacheDir, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := readLockOwner(filepath.Join(cacheDir, "lock")); err != nil || pid != os.Getpid() {
+		t.Errorf("lock owner is %d, %v, want %d", pid, err, os.Getpid())
+	}
+
+	if other, err := lockCacheDir(cacheDir, 3*lockPollInterval); err == nil {
+		unlockCacheDir(other)
+		t.Fatal("locked the cache directory twice")
+	}
+
+	unlockCacheDir(lock)
+	lock, err = lockCacheDir(cacheDir, time.Second)
+	if err != nil {
+		t.Fatalf("failed to lock the released cache directory: %s", err)
+	}
+	unlockCacheDir(lock)
+}
+
+func TestLockRemovedCacheDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows cannot remove the open lock file")
+	}
+	cacheDir := filepath.Join(t.TempDir(), "project")
+	lock, err := lockCacheDir(cacheDir, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan *os.File)
+	go func() {
+		file, err := lockCacheDir(cacheDir, 5*time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- file
+	}()
+
+	// wait until the other lock is waiting for the lock file, then remove the cache directory like
+	// a prune of a deleted project does
+	time.Sleep(3 * lockPollInterval)
+	if removed, err := removeCacheDir(cacheDir); err != nil || len(removed) != 1 {
+		t.Fatalf("removeCacheDir = %v, %v", removed, err)
+	}
+	unlockCacheDir(lock)
+
+	file := <-locked
+	if file == nil {
+		return
+	}
+	defer unlockCacheDir(file)
+	if !isSameFile(file, filepath.Join(cacheDir, "lock")) {
+		t.Error("the lock is held on the removed lock file")
+	}
+}
+
+func TestReadLockOwner(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		pid     int
+		err     bool
+	}{
+		{"1234\n", 1234, false},
+		{"42", 42, false},
+		{"", 0, true},
+		{"pid\n", 0, true},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pid, err := readLockOwner(path)
+		if (err != nil) != test.err || pid != test.pid {
+			t.Errorf("readLockOwner(%q) = %d, %v, want %d (error: %v)", test.content, pid, err, test.pid, test.err)
+		}
+	}
+	if _, err := readLockOwner(filepath.Join(dir, "missing")); err == nil {
+		t.Error("readLockOwner of a missing file returned no error")
+	}
+}
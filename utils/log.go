@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 )
@@ -50,9 +51,15 @@ var deprecationCommands = []struct {
 	commandString
 }{}
 
+// The logMutex serializes log messages of actions running in parallel.
+var logMutex sync.Mutex
+
 // Deprecation marks a target for deprecation and provide underlying commands as
 // args to the deprecation log.
 func Deprecation(target string, args ...[]string) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
 	for _, command := range args {
 		deprecationCommands = append(
 			deprecationCommands,
@@ -87,6 +94,9 @@ func LogDeprecationMessage() {
 // with the given target. The format parameter is a fmt.Printf parameter following the args for
 // formatting.
 func Log(level LogLevel, target string, format string, args ...interface{}) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
 	switch level {
 	case LOG_INFO:
 		color.Set(color.FgWhite)
@@ -0,0 +1,189 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The Manifest struct describes the layout of the manifest.json that burrow writes next to the
+// artifacts it creates (bin/ and package/).
+type Manifest struct {
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// The Artifact struct describes a file created by burrow in a manifest. The Command is the exact
+// command line the artifact was created with. The Dependencies are only known for go binaries and
+// the Contents only for archives.
+type Artifact struct {
+	Path         string       `json:"path"`
+	Size         int64        `json:"size"`
+	SHA256       string       `json:"sha256"`
+	Platform     string       `json:"platform,omitempty"`
+	Profile      string       `json:"profile,omitempty"`
+	Version      string       `json:"version"`
+	GoVersion    string       `json:"goVersion"`
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+	Contents     []Content    `json:"contents,omitempty"`
+	Command      []string     `json:"command"`
+}
+
+// The Dependency struct describes a module a go binary was built with, as reported by
+// 'go version -m'.
+type Dependency struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+	Replace string `json:"replace,omitempty"`
+}
+
+// The Content struct describes a file inside of an archive artifact.
+type Content struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewArtifact describes the file at the given path, which was created by the given command. If the
+// file is a go binary, its go version and module dependencies are read with 'go version -m',
+// otherwise the go version of the toolchain is recorded.
+func NewArtifact(file string, command []string) (Artifact, error) {
+	LoadConfig()
+	info, err := os.Stat(file)
+	if err != nil {
+		return Artifact{}, err
+	}
+	hash, err := HashFile(file)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	artifact := Artifact{
+		Path:      path.Clean(filepath.ToSlash(file)),
+		Size:      info.Size(),
+		SHA256:    hash,
+		Version:   Config.Version,
+		GoVersion: GetGoEnv()["GOVERSION"],
+		Command:   command,
+	}
+	if out, err := ExecOutput("go", "version", "-m", file); err == nil {
+		artifact.GoVersion, artifact.Dependencies = parseModuleInfo(string(out))
+	}
+	return artifact, nil
+}
+
+// parseModuleInfo reads the go version and the module dependencies from the output of
+// 'go version -m'.
+func parseModuleInfo(out string) (string, []Dependency) {
+	lines := strings.Split(out, "\n")
+	goVersion := ""
+	if index := strings.LastIndex(lines[0], ": "); index >= 0 {
+		goVersion = strings.TrimSpace(lines[0][index+2:])
+	}
+
+	dependencies := []Dependency{}
+	for _, line := range lines[1:] {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		switch {
+		case len(fields) >= 3 && fields[0] == "dep":
+			dependency := Dependency{Path: fields[1], Version: fields[2]}
+			if len(fields) >= 4 {
+				dependency.Sum = fields[3]
+			}
+			dependencies = append(dependencies, dependency)
+		case len(fields) >= 2 && fields[0] == "=>" && len(dependencies) > 0:
+			replace := fields[1]
+			if len(fields) >= 3 && fields[2] != "" {
+				replace += "@" + fields[2]
+			}
+			dependencies[len(dependencies)-1].Replace = replace
+		}
+	}
+	return goVersion, dependencies
+}
+
+// Verify checks that the file of the artifact and the contents of an archive still have the
+// recorded digests. An error describing the first stale file is returned.
+func (artifact Artifact) Verify() error {
+	hash, err := HashFile(artifact.Path)
+	if err != nil {
+		return err
+	}
+	if hash != artifact.SHA256 {
+		return fmt.Errorf("%s changed since the manifest was written", artifact.Path)
+	}
+	for _, content := range artifact.Contents {
+		hash, err := HashFile(content.Path)
+		if err != nil {
+			return err
+		}
+		if hash != content.SHA256 {
+			return fmt.Errorf("%s in %s changed since the manifest was written", content.Path, artifact.Path)
+		}
+	}
+	return nil
+}
+
+// Find returns the artifact of the manifest with the given path.
+func (manifest Manifest) Find(file string) (Artifact, bool) {
+	file = path.Clean(filepath.ToSlash(file))
+	for _, artifact := range manifest.Artifacts {
+		if artifact.Path == file {
+			return artifact, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// ReadManifest reads a manifest.json. A missing file is an empty manifest.
+func ReadManifest(file string) (Manifest, error) {
+	manifest := Manifest{Artifacts: []Artifact{}}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
+
+// WriteManifest writes a manifest.json that lists exactly the given artifacts, so the manifest only
+// describes the files of the latest build and no artifacts of earlier builds.
+func WriteManifest(file string, artifacts []Artifact) error {
+	manifest := Manifest{Artifacts: append([]Artifact{}, artifacts...)}
+	sort.Slice(manifest.Artifacts, func(i, j int) bool {
+		return manifest.Artifacts[i].Path < manifest.Artifacts[j].Path
+	})
+
+	return WriteFileAtomic(file, 0644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(manifest)
+	})
+}
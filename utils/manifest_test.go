@@ -0,0 +1,76 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteManifest(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "manifest.json")
+
+	tests := []struct {
+		name      string
+		artifacts []Artifact
+		paths     []string
+	}{
+		{"first build", []Artifact{{Path: "bin/b"}, {Path: "bin/a"}}, []string{"bin/a", "bin/b"}},
+		{"rebuild", []Artifact{{Path: "bin/a", SHA256: "new"}, {Path: "bin/b"}}, []string{"bin/a", "bin/b"}},
+		{"removed binary", []Artifact{{Path: "bin/a"}}, []string{"bin/a"}},
+		{"other platform", []Artifact{{Path: "bin/linux_arm64/a"}}, []string{"bin/linux_arm64/a"}},
+		{"no binaries", []Artifact{}, []string{}},
+	}
+	for _, test := range tests {
+		if err := WriteManifest(file, test.artifacts); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		manifest, err := ReadManifest(file)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		paths := []string{}
+		for _, artifact := range manifest.Artifacts {
+			paths = append(paths, artifact.Path)
+		}
+		if !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("%s: manifest lists %v, want %v", test.name, paths, test.paths)
+		}
+	}
+
+	if err := WriteManifest(file, []Artifact{{Path: "bin/a", SHA256: "new"}}); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := ReadManifest(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact, ok := manifest.Find("./bin/a"); !ok || artifact.SHA256 != "new" {
+		t.Errorf("Find(./bin/a) = %+v, %v, want the rewritten artifact", artifact, ok)
+	}
+	if _, ok := manifest.Find("bin/b"); ok {
+		t.Errorf("Find(bin/b) found an artifact of an earlier build")
+	}
+
+	if manifest, err := ReadManifest(filepath.Join(t.TempDir(), "missing.json")); err != nil || len(manifest.Artifacts) != 0 {
+		t.Errorf("ReadManifest of a missing file = %+v, %v, want an empty manifest", manifest, err)
+	}
+}
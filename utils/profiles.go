@@ -0,0 +1,112 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// The builtinProfiles are available in every project. A profile of the same name in the
+// burrow.yaml replaces the built-in profile.
+var builtinProfiles = map[string]Profile{
+	"debug": {
+		Gcflags: "all=-N -l",
+	},
+	"release": {
+		Flags:   "-trimpath",
+		Ldflags: "-s -w",
+		Pgo:     true,
+	},
+	"race": {
+		Flags: "-race",
+		Env:   map[string]string{"CGO_ENABLED": "1"},
+	},
+}
+
+// The profileNamePattern restricts profile names to characters that are safe in file names, as the
+// name is part of the cache entries of a profile.
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+// GetProfile returns the build profile with the given name from the burrow.yaml or the built-in
+// profiles. An empty name returns the empty default profile.
+func GetProfile(name string) (Profile, error) {
+	LoadConfig()
+	if name == "" {
+		return Profile{}, nil
+	}
+	if !profileNamePattern.MatchString(name) {
+		return Profile{}, fmt.Errorf("invalid profile name '%s'", name)
+	}
+
+	profile, ok := Config.Profiles[name]
+	if !ok {
+		profile, ok = builtinProfiles[name]
+	}
+	if !ok {
+		return Profile{}, fmt.Errorf("there is no profile named '%s'", name)
+	}
+	profile.Name = name
+	return profile, nil
+}
+
+// Args returns the go build arguments of the profile except for its tags and linker flags, which
+// have to be merged with the tags of a binary and the linker flags of the build.
+func (profile Profile) Args() ([]string, error) {
+	args, err := shellwords.Parse(profile.Flags)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Gcflags != "" {
+		args = append(args, "-gcflags", profile.Gcflags)
+	}
+	return args, nil
+}
+
+// Environ returns the environment variables of the profile in the form "key=value" sorted by key.
+func (profile Profile) Environ() []string {
+	env := []string{}
+	for key, value := range profile.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// OutputDir returns the directory the binaries of the profile are built to. Without an
+// output, the default profile is built to ./bin and every other profile to ./bin/<profile>.
+func (profile Profile) OutputDir() string {
+	if profile.Output == "" {
+		if profile.Name == "" {
+			return "./bin"
+		}
+		return "./bin/" + profile.Name
+	}
+	dir := path.Clean(filepath.ToSlash(profile.Output))
+	if filepath.IsAbs(profile.Output) {
+		return dir
+	}
+	return "./" + dir
+}
@@ -0,0 +1,171 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// The Project struct describes the identity of a burrow project. It is stored in the cache
+// directory of every project so that cache directories can be mapped back to their projects.
+type Project struct {
+	Root   string
+	Module string
+	Name   string
+}
+
+// The currentProject variable caches the identity of the current project once it got resolved.
+var currentProject *Project
+var currentProjectMutex sync.Mutex
+
+// GetProject returns the identity of the current project. The project root is the nearest directory
+// containing a burrow.yaml or go.mod, starting at the current working directory. The module path is
+// read from the go.mod in the project root.
+func GetProject() (Project, error) {
+	currentProjectMutex.Lock()
+	defer currentProjectMutex.Unlock()
+
+	if currentProject != nil {
+		return *currentProject, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return Project{}, err
+	}
+	wd, err = filepath.EvalSymlinks(wd)
+	if err != nil {
+		return Project{}, err
+	}
+
+	root := ""
+	for dir := wd; root == ""; dir = filepath.Dir(dir) {
+		for _, file := range []string{"burrow.yaml", "go.mod"} {
+			if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+				root = dir
+				break
+			}
+		}
+		if root == "" && filepath.Dir(dir) == dir {
+			return Project{}, fmt.Errorf("no burrow.yaml or go.mod found in %s or any parent directory", wd)
+		}
+	}
+
+	module, err := readModulePath(filepath.Join(root, "go.mod"))
+	if err != nil && !os.IsNotExist(err) {
+		return Project{}, err
+	}
+
+	currentProject = &Project{
+		Root:   root,
+		Module: module,
+		Name:   Config.Name,
+	}
+	return *currentProject, nil
+}
+
+// Hash returns the identifier of the project that is used as name for its cache directory.
+func (project Project) Hash() string {
+	hashSource := project.Module + "_" + project.Root
+	sha1Hasher := sha1.New()
+	sha1Hasher.Write([]byte(hashSource))
+	return base64.URLEncoding.EncodeToString(sha1Hasher.Sum(nil))
+}
+
+// GetCacheRoot returns the directory that contains the cache directories of all projects.
+func GetCacheRoot() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(usr.HomeDir, ".cache", "burrow"), nil
+}
+
+// GetCacheDir returns the cache directory of the current project. The directory is created on
+// demand and contains a project.yaml describing the project it belongs to.
+func GetCacheDir() (string, error) {
+	project, err := GetProject()
+	if err != nil {
+		return "", err
+	}
+	cacheRoot, err := GetCacheRoot()
+	if err != nil {
+		return "", err
+	}
+
+	cacheDir := filepath.Join(cacheRoot, project.Hash())
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", err
+	}
+
+	info := filepath.Join(cacheDir, "project.yaml")
+	if _, err := os.Stat(info); os.IsNotExist(err) {
+		data, err := yaml.Marshal(&project)
+		if err != nil {
+			return "", err
+		}
+		err = WriteFileAtomic(info, 0644, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return cacheDir, nil
+}
+
+// readModulePath reads the module path from a go.mod file.
+func readModulePath(gomod string) (string, error) {
+	file, err := os.Open(gomod)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "module") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "module")
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		return strings.Trim(strings.TrimSpace(line), "\"`"), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s does not contain a module directive", gomod)
+}
@@ -0,0 +1,105 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+)
+
+// The cacheKeyPattern matches all keys that are valid in a shared cache. Target metadata is stored
+// under ac/ (action cache) and artifacts under cas/ (content addressable storage).
+var cacheKeyPattern = regexp.MustCompile(`^(ac|cas)/[0-9a-f]{64}$`)
+
+// NewCacheServer creates a http.Handler that serves a shared cache from a local directory. The
+// server answers GET and PUT requests for valid cache keys and verifies the digest of all uploaded
+// artifacts.
+func NewCacheServer(dir string) http.Handler {
+	backend := FileBackend{Dir: dir}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path[1:]
+		if !cacheKeyPattern.MatchString(key) {
+			http.Error(w, "invalid cache key", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			reader, err := backend.Get(key)
+			if err == ErrCacheMiss {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer reader.Close()
+			w.Header().Set("Content-Type", "application/octet-stream")
+			if r.Method == http.MethodGet {
+				_, _ = io.Copy(w, reader)
+			}
+		case http.MethodPut:
+			if err := putVerified(backend, key, r.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// putVerified stores the data read from r in a backend. Artifacts are buffered in a temporary
+// file first and only stored if their digest matches the key.
+func putVerified(backend FileBackend, key string, r io.Reader) error {
+	if err := os.MkdirAll(backend.Dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(backend.Dir, ".upload.")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), r); err != nil {
+		return err
+	}
+	if hash := hex.EncodeToString(hasher.Sum(nil)); path.Dir(key) == "cas" && path.Base(key) != hash {
+		return fmt.Errorf("digest mismatch, expected %s but got %s", path.Base(key), hash)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return backend.Put(key, tmp)
+}
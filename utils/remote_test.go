@@ -0,0 +1,76 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCacheServer(t *testing.T) {
+	digest := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+	artifact := "cas/" + digest("artifact")
+	entry := "ac/" + digest("entry")
+
+	server := httptest.NewServer(NewCacheServer(t.TempDir()))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		key    string
+		body   string
+		status int
+	}{
+		{"missing artifact", http.MethodGet, artifact, "", http.StatusNotFound},
+		{"upload artifact", http.MethodPut, artifact, "artifact", http.StatusNoContent},
+		{"download artifact", http.MethodGet, artifact, "", http.StatusOK},
+		{"artifact with another digest", http.MethodPut, "cas/" + digest("other"), "artifact", http.StatusBadRequest},
+		{"rejected artifact is not stored", http.MethodGet, "cas/" + digest("other"), "", http.StatusNotFound},
+		{"upload entry", http.MethodPut, entry, "any content", http.StatusNoContent},
+		{"head entry", http.MethodHead, entry, "", http.StatusOK},
+		{"short digest", http.MethodGet, "cas/0123", "", http.StatusBadRequest},
+		{"upper case digest", http.MethodGet, "cas/" + strings.ToUpper(digest("artifact")), "", http.StatusBadRequest},
+		{"unknown namespace", http.MethodPut, "tmp/" + digest("artifact"), "artifact", http.StatusBadRequest},
+		{"path traversal", http.MethodGet, "cas/../" + digest("artifact"), "", http.StatusBadRequest},
+		{"unsupported method", http.MethodDelete, artifact, "", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, server.URL+"/"+test.key, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: %s %s returned %d, want %d", test.name, test.method, test.key, resp.StatusCode, test.status)
+		}
+	}
+}
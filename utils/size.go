@@ -0,0 +1,271 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The Symbol struct describes a symbol of a go binary as reported by 'go tool nm -size'.
+type Symbol struct {
+	Name    string
+	Package string
+	Size    int64
+	Type    string
+}
+
+// The SizeReport struct describes how much the packages of a go binary contribute to its size. It is
+// stored as the size baseline of a binary. Binaries without symbol table (Stripped) are reported by
+// section instead of package.
+type SizeReport struct {
+	Binary   string           `json:"binary"`
+	Version  string           `json:"version"`
+	Size     int64            `json:"size"`
+	Stripped bool             `json:"stripped,omitempty"`
+	Packages map[string]int64 `json:"packages"`
+}
+
+// ReadSymbols returns all symbols of a go binary that occupy space in the binary file. Symbols in the
+// bss sections and undefined symbols are skipped.
+func ReadSymbols(binary string) ([]Symbol, error) {
+	out, err := ExecOutput("go", "tool", "nm", "-size", "-sort", "size", binary)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := []Symbol{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size == 0 {
+			continue
+		}
+		switch fields[2] {
+		case "T", "t", "R", "r", "D", "d":
+		default:
+			continue
+		}
+		name := strings.Join(fields[3:], " ")
+		symbols = append(symbols, Symbol{
+			Name:    name,
+			Package: SymbolPackage(name),
+			Size:    size,
+			Type:    fields[2],
+		})
+	}
+	return symbols, nil
+}
+
+// HasSymbols checks whether a go binary has a symbol table. Binaries linked with -s -w, like the
+// binaries of the release profile, don't have one and 'go tool nm' cannot read them.
+func HasSymbols(binary string) (bool, error) {
+	if file, err := elf.Open(binary); err == nil {
+		defer file.Close()
+		return file.Section(".symtab") != nil, nil
+	}
+	if file, err := macho.Open(binary); err == nil {
+		defer file.Close()
+		return file.Symtab != nil && len(file.Symtab.Syms) > 0, nil
+	}
+	file, err := pe.Open(binary)
+	if err != nil {
+		return false, fmt.Errorf("%s is no ELF, Mach-O or PE binary", binary)
+	}
+	defer file.Close()
+	return len(file.Symbols) > 0, nil
+}
+
+// ReadSections returns the sections of a go binary that occupy space in the binary file as symbols
+// of the type "section", sorted by size. The name of a section is used as its package, so a size
+// report of the sections can be made for binaries without symbol table.
+func ReadSections(binary string) ([]Symbol, error) {
+	sizes := map[string]int64{}
+	if file, err := elf.Open(binary); err == nil {
+		defer file.Close()
+		for _, section := range file.Sections {
+			if section.Type != elf.SHT_NOBITS {
+				sizes[section.Name] += int64(section.Size)
+			}
+		}
+	} else if file, err := macho.Open(binary); err == nil {
+		defer file.Close()
+		for _, section := range file.Sections {
+			// zero filled sections like __bss do not occupy space in the file
+			if section.Offset != 0 {
+				sizes[section.Seg+"."+section.Name] += int64(section.Size)
+			}
+		}
+	} else if file, err := pe.Open(binary); err == nil {
+		defer file.Close()
+		for _, section := range file.Sections {
+			sizes[section.Name] += int64(section.Size)
+		}
+	} else {
+		return nil, fmt.Errorf("%s is no ELF, Mach-O or PE binary", binary)
+	}
+
+	sections := []Symbol{}
+	for name, size := range sizes {
+		if name != "" && size > 0 {
+			sections = append(sections, Symbol{Name: name, Package: name, Size: size, Type: "section"})
+		}
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		if sections[i].Size != sections[j].Size {
+			return sections[i].Size > sections[j].Size
+		}
+		return sections[i].Name < sections[j].Name
+	})
+	return sections, nil
+}
+
+// SymbolPackage returns the import path of the package a symbol belongs to. Symbols generated by the
+// compiler are grouped by their prefix, e.g. "type:" or "go:".
+func SymbolPackage(name string) string {
+	if index := strings.Index(name, ":"); index > 0 && !strings.ContainsAny(name[:index], "./") {
+		return name[:index+1]
+	}
+	if index := strings.IndexAny(name, "[("); index >= 0 {
+		name = name[:index]
+	}
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "<other>"
+	}
+	return name[:slash+1+dot]
+}
+
+// NewSizeReport reads the size of a go binary and sums up the sizes of its symbols by package.
+func NewSizeReport(binary string, symbols []Symbol) (SizeReport, error) {
+	LoadConfig()
+	info, err := os.Stat(binary)
+	if err != nil {
+		return SizeReport{}, err
+	}
+
+	report := SizeReport{
+		Binary:   filepath.ToSlash(filepath.Clean(binary)),
+		Version:  Config.Version,
+		Size:     info.Size(),
+		Packages: map[string]int64{},
+	}
+	for _, symbol := range symbols {
+		report.Packages[symbol.Package] += symbol.Size
+	}
+	return report, nil
+}
+
+// sizeBaselineFile returns the path of the file the size baseline of a binary is stored in.
+func sizeBaselineFile(binary string) string {
+	name := strings.Replace(filepath.ToSlash(filepath.Clean(binary)), "/", "_", -1)
+	return filepath.Join(".burrow", "size", name+".json")
+}
+
+// ReadSizeBaseline returns the stored size baseline of a binary. The flag is false if there is no
+// baseline.
+func ReadSizeBaseline(binary string) (SizeReport, bool, error) {
+	data, err := ioutil.ReadFile(sizeBaselineFile(binary))
+	if os.IsNotExist(err) {
+		return SizeReport{}, false, nil
+	}
+	if err != nil {
+		return SizeReport{}, false, err
+	}
+	report := SizeReport{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return SizeReport{}, false, err
+	}
+	return report, true, nil
+}
+
+// WriteSizeBaseline stores a size report as the baseline of its binary.
+func WriteSizeBaseline(report SizeReport) error {
+	return WriteFileAtomic(sizeBaselineFile(report.Binary), 0644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	})
+}
+
+// The SizeLimit struct describes how much a binary may grow compared to its baseline, either
+// relative (Percent) or absolute (Bytes).
+type SizeLimit struct {
+	Relative bool
+	Percent  float64
+	Bytes    int64
+}
+
+// ParseSizeLimit parses a size limit, which is either a percentage like "5%" or a size in bytes with
+// an optional unit like "64KiB", "2MB" or "512".
+func ParseSizeLimit(value string) (SizeLimit, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+		if err != nil {
+			return SizeLimit{}, fmt.Errorf("invalid percentage '%s'", value)
+		}
+		return SizeLimit{Relative: true, Percent: percent}, nil
+	}
+
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1000}, {"MB", 1000 * 1000}, {"GB", 1000 * 1000 * 1000}, {"B", 1},
+	}
+	number := value
+	factor := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix))
+			factor = unit.factor
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return SizeLimit{}, fmt.Errorf("invalid size '%s'", value)
+	}
+	return SizeLimit{Bytes: int64(size * float64(factor))}, nil
+}
+
+// Exceeded returns whether the growth from the baseline size to the current size exceeds the limit.
+func (limit SizeLimit) Exceeded(baseline int64, size int64) bool {
+	if limit.Relative {
+		return baseline > 0 && float64(size-baseline)*100 > limit.Percent*float64(baseline)
+	}
+	return size-baseline > limit.Bytes
+}
@@ -0,0 +1,74 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import "testing"
+
+func TestParseSizeLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		limit SizeLimit
+		err   bool
+	}{
+		{"5%", SizeLimit{Relative: true, Percent: 5}, false},
+		{"0.5 %", SizeLimit{Relative: true, Percent: 0.5}, false},
+		{"512", SizeLimit{Bytes: 512}, false},
+		{"512B", SizeLimit{Bytes: 512}, false},
+		{"64KiB", SizeLimit{Bytes: 64 << 10}, false},
+		{"2 MiB", SizeLimit{Bytes: 2 << 20}, false},
+		{"1GiB", SizeLimit{Bytes: 1 << 30}, false},
+		{"2MB", SizeLimit{Bytes: 2000000}, false},
+		{"1.5KB", SizeLimit{Bytes: 1500}, false},
+		{" 3GB ", SizeLimit{Bytes: 3000000000}, false},
+		{"%", SizeLimit{}, true},
+		{"five%", SizeLimit{}, true},
+		{"MB", SizeLimit{}, true},
+		{"2TB", SizeLimit{}, true},
+		{"", SizeLimit{}, true},
+	}
+	for _, test := range tests {
+		limit, err := ParseSizeLimit(test.value)
+		if (err != nil) != test.err || limit != test.limit {
+			t.Errorf("ParseSizeLimit(%q) = %+v, %v, want %+v (error: %v)", test.value, limit, err, test.limit, test.err)
+		}
+	}
+}
+
+func TestSizeLimitExceeded(t *testing.T) {
+	tests := []struct {
+		limit    SizeLimit
+		baseline int64
+		size     int64
+		exceeded bool
+	}{
+		{SizeLimit{Relative: true, Percent: 5}, 1000, 1050, false},
+		{SizeLimit{Relative: true, Percent: 5}, 1000, 1051, true},
+		{SizeLimit{Relative: true, Percent: 5}, 1000, 900, false},
+		{SizeLimit{Relative: true, Percent: 5}, 0, 1000, false},
+		{SizeLimit{Bytes: 100}, 1000, 1100, false},
+		{SizeLimit{Bytes: 100}, 1000, 1101, true},
+		{SizeLimit{Bytes: 0}, 1000, 1001, true},
+	}
+	for _, test := range tests {
+		if exceeded := test.limit.Exceeded(test.baseline, test.size); exceeded != test.exceeded {
+			t.Errorf("%+v.Exceeded(%d, %d) = %v, want %v", test.limit, test.baseline, test.size, exceeded, test.exceeded)
+		}
+	}
+}
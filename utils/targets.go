@@ -20,131 +20,376 @@
 package burrow
 
 import (
-	"crypto/sha1"
-	"encoding/base64"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"math"
 	"os"
-	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/urfave/cli"
 	"gopkg.in/yaml.v2"
 )
 
+// The targetState map caches whether a target is up-to-date during a run of burrow. Targets may be
+// run in parallel, so the map is guarded by the targetStateMutex.
 var targetState = map[string]bool{}
-var projectHash string
+var targetStateMutex sync.Mutex
+
+// The FileState struct describes the content of a file at the time it got recorded in the target
+// cache. The modification time and size are only used as a hint to skip hashing files that did not
+// change since they were last recorded, the freshness of a target is decided on the SHA-256 digest.
+type FileState struct {
+	Mtime int64
+	Size  int64
+	Mode  uint32
+	Hash  string
+}
+
+// The Target struct describes a cacheable action of burrow. The Inputs are all files the action
+// reads, the Outputs are all files (artifacts) the action creates. The Args contain the resolved
+// arguments the action is run with. Together with the go environment they form the cache key of the
+// target, so every combination of arguments and toolchain gets its own cache entry. The Env contains
+// additional environment variables (e.g. GOOS and GOARCH) the action is run with.
+type Target struct {
+	Name    string
+	Args    []string
+	Env     []string
+	Inputs  []string
+	Outputs []string
+}
+
+// The TargetCache struct describes the layout of a target cache file.
+type TargetCache struct {
+	Target    string
+	Args      []string
+	Overrides []string `yaml:",omitempty"`
+	Env       map[string]string
+	Inputs    map[string]FileState
+	Outputs   map[string]FileState
+}
+
+// CacheKey returns the name of the cache entry of the target. The name is derived from the target
+// name, its arguments, its outputs and the go environment.
+func (target Target) CacheKey() string {
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "target %q\n", target.Name)
+	for _, arg := range target.Args {
+		fmt.Fprintf(hasher, "arg %q\n", arg)
+	}
+	for _, output := range target.Outputs {
+		fmt.Fprintf(hasher, "output %q\n", output)
+	}
+
+	for _, val := range target.Env {
+		fmt.Fprintf(hasher, "setenv %q\n", val)
+	}
+	env := GetGoEnvFor(target.Env)
+	for _, name := range goEnvVars {
+		fmt.Fprintf(hasher, "env %s=%q\n", name, env[name])
+	}
+
+	return target.Name + "-" + hex.EncodeToString(hasher.Sum(nil))[:16]
+}
+
+// The fileStates map holds every file state that has been computed during this run of burrow, so
+// that files are hashed at most once even when multiple targets share the same inputs.
+var fileStates = map[string]FileState{}
+var fileStatesMutex sync.Mutex
 
 // IsTargetUpToDate checks whether a given build target is up-to-date. This means that all build
-// artifacts of the target were created from data with the same timestamp as the currently
+// artifacts of the target were created from sources with the same content as the currently
 // available sources.
 //
-// The outputs parameter specifies which files are created (artifacts) by the target. If these
-// files are not available all cache data is invalid.
-func IsTargetUpToDate(target string, outputs []string) bool {
+// If the outputs of the target are not available or their content changed all cache data is
+// invalid. The caller has to hold the project lock, see LockProject.
+func IsTargetUpToDate(target Target) bool {
 	LoadConfig()
 
-	isTargetUpToDate, ok := targetState[target]
+	key := target.CacheKey()
+	targetStateMutex.Lock()
+	isTargetUpToDate, ok := targetState[key]
+	targetStateMutex.Unlock()
 	if ok {
 		return isTargetUpToDate
 	}
 
-	if projectHash == "" {
-		projectDir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
-		hashSource := Config.Name + "_" + projectDir
-		sha1Hasher := sha1.New()
-		sha1Hasher.Write([]byte(hashSource))
-		projectHash = base64.URLEncoding.EncodeToString(sha1Hasher.Sum(nil))
+	local, err := GetLocalBackend()
+	if err != nil {
+		Log(LOG_WARN, target.Name, "Failed to access target cache: %s", err)
+		setTargetState(key, false)
+		return false
 	}
 
-	usr, _ := user.Current()
-	_ = os.MkdirAll(usr.HomeDir+"/.cache/burrow/", 0755)
-	_ = os.MkdirAll(usr.HomeDir+"/.cache/burrow/"+projectHash, 0755)
+	upToDate := isTargetCached(target, key, local) ||
+		restoreTarget(target, local, "local cache") ||
+		restoreTarget(target, GetRemoteBackend(), "remote cache")
+
+	setTargetState(key, upToDate)
+	return upToDate
+}
+
+// setTargetState records whether the target with the given cache key is up-to-date.
+func setTargetState(key string, upToDate bool) {
+	targetStateMutex.Lock()
+	defer targetStateMutex.Unlock()
+	targetState[key] = upToDate
+}
 
-	cache, err := ioutil.ReadFile(usr.HomeDir + "/.cache/burrow/" + projectHash + "/" + target)
+// UpdateTarget updates the cache of a target to match the content of all currently available
+// inputs of the target. Digests of the outputs (artifacts) of the target will also be stored and the
+// outputs themselves are kept in the cache, so they can be restored when the same inputs occur
+// again. If a remote cache is configured, the outputs of the target are uploaded to it as well.
+func UpdateTarget(target Target) {
+	inputs, err := GetFileStates(target.Inputs)
 	if err != nil {
-		targetState[target] = false
-		return false
+		Log(LOG_WARN, target.Name, "Failed to update target cache: %s", err)
+		return
+	}
+	outputStates, err := GetFileStates(target.Outputs)
+	if err != nil {
+		Log(LOG_WARN, target.Name, "Failed to update target cache: %s", err)
+		return
+	}
+
+	cache := TargetCache{
+		Target:    target.Name,
+		Args:      target.Args,
+		Overrides: target.Env,
+		Env:       GetGoEnvFor(target.Env),
+		Inputs:    inputs,
+		Outputs:   outputStates,
+	}
+	if err := writeTargetCache(target, cache); err != nil {
+		Log(LOG_WARN, target.Name, "Failed to update target cache: %s", err)
+		return
 	}
 
-	codeFiles := GetCodefilesWithMtime(outputs)
+	local, err := GetLocalBackend()
+	if err == nil {
+		err = storeTarget(target, cache, local)
+	}
+	if err != nil {
+		Log(LOG_WARN, target.Name, "Failed to store outputs in target cache: %s", err)
+	}
+
+	if remote := GetRemoteBackend(); remote != nil && !Config.Cache.ReadOnly {
+		if err := storeTarget(target, cache, remote); err != nil {
+			Log(LOG_WARN, target.Name, "Failed to upload target to remote cache: %s", err)
+		}
+	}
+}
 
-	cachedCodeFiles := map[string]int64{}
-	err = yaml.Unmarshal(cache, &cachedCodeFiles)
+// isTargetCached checks whether the local cache entry of a target matches the current inputs and
+// outputs of the target.
+func isTargetCached(target Target, key string, local FileBackend) bool {
+	cache, err := fetchTargetCache(local, key)
+	if err == ErrCacheMiss {
+		return false
+	}
+	if err == nil {
+		err = cache.validate(target.Name)
+	}
 	if err != nil {
-		targetState[target] = false
+		Log(LOG_WARN, target.Name, "Discarding corrupt cache entry %s: %s", key, err)
+		if err := local.Remove(key); err != nil {
+			Log(LOG_WARN, target.Name, "Failed to remove corrupt cache entry: %s", err)
+		}
 		return false
 	}
 
-	for path, mtime := range codeFiles {
-		cachedMtime, ok := cachedCodeFiles[path]
-		if !ok || cachedMtime < mtime {
-			targetState[target] = false
-			return false
-		}
+	if describeChanges("input", target.Inputs, cache.Inputs) != "" ||
+		describeChanges("output", target.Outputs, cache.Outputs) != "" {
+		return false
 	}
 
-	targetState[target] = true
 	return true
 }
 
-// UpdateTarget updates the cache of a target to match the timestamps of all currently available sources.
-// The outputs parameter specifies which files are created (artifacts) by the target. Timestamps of the
-// artifacts will also be stored.
-func UpdateTarget(target string, outputs []string) {
-	cache := GetCodefilesWithMtime(outputs)
+// writeTargetCache stores the cache entry of a target in the local cache.
+func writeTargetCache(target Target, cache TargetCache) error {
 	ser, err := yaml.Marshal(&cache)
 	if err != nil {
-		Log(LOG_WARN, target, "Failed to update target cache, ignoring...")
-		return
+		return err
 	}
-	usr, err := user.Current()
+	local, err := GetLocalBackend()
 	if err != nil {
-		Log(LOG_WARN, target, "Failed to update target cache: $s", err)
-		return
+		return err
+	}
+	return local.Put(target.CacheKey(), bytes.NewReader(ser))
+}
+
+// validate checks whether a parsed cache entry is complete and belongs to the given target.
+func (cache TargetCache) validate(target string) error {
+	if cache.Target != target {
+		return fmt.Errorf("entry belongs to target %q", cache.Target)
+	}
+	if cache.Inputs == nil || cache.Outputs == nil || cache.Env == nil {
+		return errors.New("entry is incomplete")
 	}
-	err = ioutil.WriteFile(usr.HomeDir+"/.cache/burrow/"+projectHash+"/"+target, ser, 0644)
+	return nil
+}
+
+// fetchTargetCache reads and parses the target cache entry stored for key in a cache backend.
+func fetchTargetCache(backend CacheBackend, key string) (TargetCache, error) {
+	cache := TargetCache{}
+	reader, err := backend.Get(key)
 	if err != nil {
-		Log(LOG_WARN, target, "Failed to update target cache, ignoring...")
-		return
+		return cache, err
 	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return cache, err
+	}
+	err = yaml.Unmarshal(data, &cache)
+	return cache, err
 }
 
-// GetCodefiles returns a string array containing all paths of files that contain code inside the
-// current burrow project.
-func GetCodefiles() []string {
-	codeFiles := []string{}
-	_ = filepath.Walk(".", func(path string, f os.FileInfo, err error) error {
-		if strings.HasSuffix(path, ".go") && !strings.Contains(path, "vendor/") {
-			codeFiles = append(codeFiles, path)
+// readTargetCache reads and parses the target cache file at the given path.
+func readTargetCache(path string) (TargetCache, error) {
+	cache := TargetCache{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache, err
+	}
+	err = yaml.Unmarshal(data, &cache)
+	return cache, err
+}
+
+// describeChanges compares the given paths with a set of cached file states and returns a
+// description of the first difference, e.g. "input main.go changed". If the paths match exactly the
+// set of cached file states and the content of every file is the same as the cached content, an
+// empty string is returned. The kind parameter is used as noun in the description.
+func describeChanges(kind string, paths []string, cached map[string]FileState) string {
+	current := map[string]bool{}
+	for _, path := range paths {
+		current[path] = true
+		if _, ok := cached[path]; !ok {
+			return fmt.Sprintf("new %s %s", kind, path)
 		}
-		return nil
-	})
-	return codeFiles
+	}
+	for _, path := range sortedKeys(cached) {
+		if !current[path] {
+			return fmt.Sprintf("%s %s removed", kind, path)
+		}
+	}
+
+	for _, path := range paths {
+		state, err := GetFileState(path, cached[path])
+		if err != nil {
+			return fmt.Sprintf("%s %s missing", kind, path)
+		}
+		if state.Hash != cached[path].Hash {
+			return fmt.Sprintf("%s %s changed", kind, path)
+		}
+	}
+
+	return ""
 }
 
-// GetCodefilesWithMtime returns a map containing all paths of files that contain code inside the
-// current burrow project. The paths get mapped to Unix modification times. The outputs parameter
-// should contain additional non-code files that should also be contained in the map.
-func GetCodefilesWithMtime(outputs []string) map[string]int64 {
-	codeFiles := map[string]int64{}
-	_ = filepath.Walk(".", func(path string, f os.FileInfo, err error) error {
-		if strings.HasSuffix(path, ".go") || strings.HasSuffix(path, ".yaml") {
-			codeFiles[path] = f.ModTime().Unix()
+// sortedKeys returns the paths of a set of file states in lexical order.
+func sortedKeys(states map[string]FileState) []string {
+	keys := make([]string, 0, len(states))
+	for key := range states {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetFileState returns the current state of the file at the given path. The hint parameter can
+// contain a previously recorded state of the same file. When modification time and size of the file
+// still match the hint, the recorded digest is reused instead of hashing the file again.
+func GetFileState(path string, hint FileState) (FileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileState{}, err
+	}
+
+	state := FileState{
+		Mtime: info.ModTime().UnixNano(),
+		Size:  info.Size(),
+		Mode:  uint32(info.Mode().Perm()),
+	}
+
+	fileStatesMutex.Lock()
+	known, ok := fileStates[path]
+	fileStatesMutex.Unlock()
+	if ok && known.Mtime == state.Mtime && known.Size == state.Size {
+		return known, nil
+	}
+
+	if hint.Hash != "" && hint.Mtime == state.Mtime && hint.Size == state.Size {
+		state.Hash = hint.Hash
+	} else {
+		state.Hash, err = HashFile(path)
+		if err != nil {
+			return FileState{}, err
 		}
-		return nil
-	})
+	}
 
-	for _, output := range outputs {
-		info, err := os.Stat(output)
+	fileStatesMutex.Lock()
+	fileStates[path] = state
+	fileStatesMutex.Unlock()
+	return state, nil
+}
+
+// GetFileStates returns a map containing the current state of every file in paths.
+func GetFileStates(paths []string) (map[string]FileState, error) {
+	states := map[string]FileState{}
+	for _, path := range paths {
+		state, err := GetFileState(path, FileState{})
 		if err != nil {
-			codeFiles[output] = math.MaxInt64
-		} else {
-			codeFiles[output] = info.ModTime().Unix()
+			return nil, err
 		}
+		states[path] = state
 	}
+	return states, nil
+}
 
+// HashFile returns the hex encoded SHA-256 digest of the content of the file at the given path.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// GetCodefiles returns a string array containing all paths of files that contain code inside the
+// current burrow project. Files matching the ignore patterns of the project are skipped, as well as
+// testdata directories, which the go tool ignores too.
+func GetCodefiles() []string {
+	codeFiles := []string{}
+	_ = filepath.Walk(".", func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if IsIgnored(path) || (f.IsDir() && f.Name() == "testdata") {
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".go") && !f.IsDir() {
+			codeFiles = append(codeFiles, path)
+		}
+		return nil
+	})
 	return codeFiles
 }
 
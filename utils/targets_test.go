@@ -0,0 +1,114 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDescribeChanges(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	other := filepath.Join(dir, "other.go")
+
+	tests := []struct {
+		name        string
+		change      func() error
+		paths       []string
+		description string
+	}{
+		{"same content", func() error { return nil }, []string{file}, ""},
+		{"touched", func() error {
+			later := time.Now().Add(time.Hour)
+			return os.Chtimes(file, later, later)
+		}, []string{file}, ""},
+		{"rewritten with the same content", func() error {
+			return ioutil.WriteFile(file, []byte("package main\n"), 0644)
+		}, []string{file}, ""},
+		{"changed content of the same size", func() error {
+			if err := ioutil.WriteFile(file, []byte("package mein\n"), 0644); err != nil {
+				return err
+			}
+			later := time.Now().Add(time.Hour)
+			return os.Chtimes(file, later, later)
+		}, []string{file}, "input " + file + " changed"},
+		{"removed", func() error { return os.Remove(file) }, []string{file}, "input " + file + " missing"},
+		{"added", func() error {
+			return ioutil.WriteFile(other, []byte("package main\n"), 0644)
+		}, []string{file, other}, "new input " + other},
+		{"no longer an input", func() error { return nil }, []string{}, "input " + file + " removed"},
+	}
+	for _, test := range tests {
+		fileStates = map[string]FileState{}
+		if err := ioutil.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cached, err := GetFileStates([]string{file})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := test.change(); err != nil {
+			t.Fatal(err)
+		}
+
+		fileStates = map[string]FileState{}
+		if description := describeChanges("input", test.paths, cached); description != test.description {
+			t.Errorf("%s: describeChanges = %q, want %q", test.name, description, test.description)
+		}
+		_ = os.Remove(other)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	base := Target{Name: "build", Args: []string{"build", "-o", "bin/app"}, Outputs: []string{"bin/app"}}
+	baseEnv := map[string]string{"GOOS": "linux", "GOARCH": "amd64"}
+
+	tests := []struct {
+		name   string
+		target Target
+		env    map[string]string
+		same   bool
+	}{
+		{"same target", base, baseEnv, true},
+		{"other inputs", Target{Name: "build", Args: base.Args, Inputs: []string{"main.go"}, Outputs: base.Outputs}, baseEnv, true},
+		{"other name", Target{Name: "install", Args: base.Args, Outputs: base.Outputs}, baseEnv, false},
+		{"other argument", Target{Name: "build", Args: []string{"build", "-o", "bin/other"}, Outputs: base.Outputs}, baseEnv, false},
+		{"reordered arguments", Target{Name: "build", Args: []string{"-o", "bin/app", "build"}, Outputs: base.Outputs}, baseEnv, false},
+		{"joined arguments", Target{Name: "build", Args: []string{"build -o", "bin/app"}, Outputs: base.Outputs}, baseEnv, false},
+		{"other output", Target{Name: "build", Args: base.Args, Outputs: []string{"bin/other"}}, baseEnv, false},
+		{"other GOOS", base, map[string]string{"GOOS": "windows", "GOARCH": "amd64"}, false},
+		{"other CGO_ENABLED", base, map[string]string{"GOOS": "linux", "GOARCH": "amd64", "CGO_ENABLED": "0"}, false},
+		{"unrelated variable", base, map[string]string{"GOOS": "linux", "GOARCH": "amd64", "HOME": "/root"}, true},
+		{"target environment", Target{Name: "build", Args: base.Args, Outputs: base.Outputs, Env: []string{"GOOS=linux"}}, baseEnv, false},
+	}
+	defer func() { goEnvs = map[string]map[string]string{} }()
+	goEnvs = map[string]map[string]string{"": baseEnv, "GOOS=linux": baseEnv}
+	key := base.CacheKey()
+	for _, test := range tests {
+		goEnvs = map[string]map[string]string{"": test.env, "GOOS=linux": test.env}
+		if same := test.target.CacheKey() == key; same != test.same {
+			t.Errorf("%s: same cache key = %v, want %v", test.name, same, test.same)
+		}
+	}
+}
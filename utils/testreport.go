@@ -0,0 +1,440 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The TestEvent struct describes a line of the output of 'go test -json', see 'go doc test2json'.
+// Build output is reported with the ImportPath instead of the Package.
+type TestEvent struct {
+	Time       time.Time
+	Action     string
+	Package    string
+	ImportPath string
+	Test       string
+	Elapsed    float64
+	Output     string
+}
+
+// The TestResult struct describes the result of a single test or subtest in a test report. The
+// output is only kept for failed and skipped tests. A flaky test passed after it was retried, its
+// output is the output of the last failed attempt.
+type TestResult struct {
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	Elapsed float64 `json:"elapsed"`
+	Retries int     `json:"retries,omitempty"`
+	Flaky   bool    `json:"flaky,omitempty"`
+	Output  string  `json:"output,omitempty"`
+}
+
+// The PackageResult struct describes the test results of a package in a test report. The output of
+// the package is only kept if the package failed. Cached results are from a previous run of the
+// tests whose inputs did not change since.
+type PackageResult struct {
+	Name    string       `json:"name"`
+	Status  string       `json:"status"`
+	Elapsed float64      `json:"elapsed"`
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+	Skipped int          `json:"skipped"`
+	Flaky   int          `json:"flaky"`
+	Cached  bool         `json:"cached,omitempty"`
+	Tests   []TestResult `json:"tests"`
+	Output  string       `json:"output,omitempty"`
+}
+
+// The TestReport struct describes the results of a run of 'go test'. It is the layout of the JSON
+// report of 'burrow test --report json=...'.
+type TestReport struct {
+	Passed   int             `json:"passed"`
+	Failed   int             `json:"failed"`
+	Skipped  int             `json:"skipped"`
+	Flaky    int             `json:"flaky"`
+	Elapsed  float64         `json:"elapsed"`
+	Packages []PackageResult `json:"packages"`
+}
+
+// The TestRecorder struct reads the output of 'go test -json' and collects the results of all
+// packages and tests. The output of the tests is logged like 'go test' would print it: the output of
+// passing tests is only logged in verbose mode.
+type TestRecorder struct {
+	target   string
+	verbose  bool
+	mutex    sync.Mutex
+	partial  []byte
+	packages map[string]*PackageResult
+	tests    map[string]map[string]int
+	outputs  map[string]map[string]*strings.Builder
+}
+
+// NewTestRecorder creates a test recorder that logs the test output with the given target.
+func NewTestRecorder(target string, verbose bool) *TestRecorder {
+	return &TestRecorder{
+		target:   target,
+		verbose:  verbose,
+		packages: map[string]*PackageResult{},
+		tests:    map[string]map[string]int{},
+		outputs:  map[string]map[string]*strings.Builder{},
+	}
+}
+
+// Write reads the lines of the output of 'go test -json'. Lines that are not test events are logged
+// as they are.
+func (recorder *TestRecorder) Write(payload []byte) (int, error) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.partial = append(recorder.partial, payload...)
+	for {
+		index := bytes.IndexByte(recorder.partial, '\n')
+		if index < 0 {
+			break
+		}
+		line := recorder.partial[:index]
+		recorder.partial = recorder.partial[index+1:]
+
+		event := TestEvent{}
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &event) != nil {
+			if len(bytes.TrimSpace(line)) > 0 {
+				Log(LOG_INFO, recorder.target, "%s", string(line))
+			}
+			continue
+		}
+		recorder.handle(event)
+	}
+	return len(payload), nil
+}
+
+// pkg returns the result of the package with the given name.
+func (recorder *TestRecorder) pkg(name string) *PackageResult {
+	result, ok := recorder.packages[name]
+	if !ok {
+		result = &PackageResult{Name: name, Tests: []TestResult{}}
+		recorder.packages[name] = result
+		recorder.tests[name] = map[string]int{}
+		recorder.outputs[name] = map[string]*strings.Builder{}
+	}
+	return result
+}
+
+// test returns the result of a test of a package and the output recorded for the test so far.
+func (recorder *TestRecorder) test(name string, test string) (*TestResult, *strings.Builder) {
+	result := recorder.pkg(name)
+	index, ok := recorder.tests[name][test]
+	if !ok {
+		index = len(result.Tests)
+		result.Tests = append(result.Tests, TestResult{Name: test})
+		recorder.tests[name][test] = index
+		recorder.outputs[name][test] = &strings.Builder{}
+	}
+	return &result.Tests[index], recorder.outputs[name][test]
+}
+
+// handle records a single test event.
+func (recorder *TestRecorder) handle(event TestEvent) {
+	output := strings.TrimSuffix(event.Output, "\n")
+
+	switch {
+	case event.Action == "build-output":
+		Log(LOG_WARN, recorder.target, "%s", output)
+		if fields := strings.Fields(event.ImportPath); len(fields) > 0 {
+			recorder.pkg(fields[0]).Output += event.Output
+		}
+	case event.Action == "build-fail":
+	case event.Test == "":
+		result := recorder.pkg(event.Package)
+		switch event.Action {
+		case "output":
+			result.Output += event.Output
+			if recorder.verbose || output != "PASS" {
+				Log(LOG_INFO, recorder.target, "%s", output)
+			}
+		case "pass", "fail", "skip":
+			result.Status = event.Action
+			result.Elapsed = event.Elapsed
+		}
+	default:
+		result, buffer := recorder.test(event.Package, event.Test)
+		switch event.Action {
+		case "output":
+			// the framing lines of the verbose output are not part of the test output
+			if !strings.HasPrefix(event.Output, "=== ") {
+				buffer.WriteString(event.Output)
+			}
+			if recorder.verbose {
+				Log(LOG_INFO, recorder.target, "%s", output)
+			}
+		case "pass", "fail", "skip":
+			result.Status = event.Action
+			result.Elapsed = event.Elapsed
+			if event.Action != "pass" {
+				result.Output = buffer.String()
+			}
+			if event.Action == "fail" && !recorder.verbose {
+				for _, line := range strings.Split(strings.TrimSuffix(result.Output, "\n"), "\n") {
+					Log(LOG_INFO, recorder.target, "%s", line)
+				}
+			}
+		}
+	}
+}
+
+// Report returns the results recorded so far. Packages and tests that did not finish are reported
+// as failed.
+func (recorder *TestRecorder) Report() TestReport {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	report := TestReport{Packages: []PackageResult{}}
+	for _, pkg := range recorder.packages {
+		result := *pkg
+		result.Tests = append([]TestResult{}, pkg.Tests...)
+		for i := range result.Tests {
+			test := &result.Tests[i]
+			if test.Status == "" {
+				test.Status = "fail"
+				test.Output = recorder.outputs[pkg.Name][test.Name].String()
+			}
+		}
+		result.count()
+		if result.Status == "" {
+			result.Status = "fail"
+		}
+		if result.Status != "fail" {
+			result.Output = ""
+		}
+
+		report.Add(result)
+	}
+	return report
+}
+
+// count counts the passed, failed, skipped and flaky tests of the package.
+func (result *PackageResult) count() {
+	result.Passed, result.Failed, result.Skipped, result.Flaky = 0, 0, 0, 0
+	for _, test := range result.Tests {
+		switch test.Status {
+		case "pass":
+			result.Passed++
+		case "fail":
+			result.Failed++
+		case "skip":
+			result.Skipped++
+		}
+		if test.Flaky {
+			result.Flaky++
+		}
+	}
+}
+
+// FailedTests returns the names of the top-level tests of the package that failed. A failed subtest
+// fails its top-level test as well.
+func (result PackageResult) FailedTests() []string {
+	names := []string{}
+	for _, test := range result.Tests {
+		name := strings.SplitN(test.Name, "/", 2)[0]
+		if test.Status == "fail" && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Retry updates the result of the package with the result of a retry of its failed tests. Tests
+// that failed before and passed in the retry are flaky. The package passes if no test failed in the
+// retry.
+func (result *PackageResult) Retry(retry PackageResult, attempt int) {
+	index := map[string]int{}
+	for i, test := range result.Tests {
+		index[test.Name] = i
+	}
+	for _, test := range retry.Tests {
+		i, ok := index[test.Name]
+		if !ok {
+			index[test.Name] = len(result.Tests)
+			result.Tests = append(result.Tests, test)
+			continue
+		}
+		previous := result.Tests[i]
+		test.Retries = attempt
+		test.Flaky = previous.Flaky || (previous.Status == "fail" && test.Status == "pass")
+		if test.Status == "pass" && test.Flaky {
+			test.Output = previous.Output
+		}
+		result.Tests[i] = test
+	}
+
+	result.count()
+	result.Elapsed += retry.Elapsed
+	if retry.Status == "fail" || result.Failed > 0 {
+		result.Status = "fail"
+		result.Output = retry.Output
+	} else {
+		result.Status = "pass"
+		result.Output = ""
+	}
+}
+
+// containsString checks whether the list contains the value.
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds the result of a package to the report. The packages of the report are kept sorted by
+// name.
+func (report *TestReport) Add(result PackageResult) {
+	report.Passed += result.Passed
+	report.Failed += result.Failed
+	report.Skipped += result.Skipped
+	report.Flaky += result.Flaky
+	report.Elapsed += result.Elapsed
+	report.Packages = append(report.Packages, result)
+	sort.Slice(report.Packages, func(i, j int) bool {
+		return report.Packages[i].Name < report.Packages[j].Name
+	})
+}
+
+// WriteJSON writes the test report as JSON file.
+func (report TestReport) WriteJSON(file string) error {
+	return WriteFileAtomic(file, 0644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	})
+}
+
+// The junitTestSuites struct describes the root element of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// The junitTestSuite struct describes the results of a package in a JUnit XML report. A package that
+// failed without a failing test (e.g. because it does not compile) is reported as error.
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+// The junitTestCase struct describes the result of a test in a JUnit XML report. Flaky tests have a
+// flakyFailure element like in the reports of the Maven Surefire plugin.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Flaky     *junitMessage `xml:"flakyFailure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+// The junitMessage struct describes the failure or skip reason of a test in a JUnit XML report.
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the test report as JUnit XML file. Every package is a test suite.
+func (report TestReport) WriteJUnit(file string) error {
+	suites := junitTestSuites{
+		Tests:    report.Passed + report.Failed + report.Skipped,
+		Failures: report.Failed,
+		Skipped:  report.Skipped,
+		Time:     junitTime(report.Elapsed),
+		Suites:   []junitTestSuite{},
+	}
+	for _, pkg := range report.Packages {
+		suite := junitTestSuite{
+			Name:     pkg.Name,
+			Tests:    len(pkg.Tests),
+			Failures: pkg.Failed,
+			Skipped:  pkg.Skipped,
+			Time:     junitTime(pkg.Elapsed),
+			Cases:    []junitTestCase{},
+		}
+		if pkg.Status == "fail" && pkg.Failed == 0 {
+			suite.Errors = 1
+			suites.Errors++
+		}
+		if pkg.Status == "fail" {
+			suite.SystemOut = pkg.Output
+		}
+		for _, test := range pkg.Tests {
+			testCase := junitTestCase{Name: test.Name, Classname: pkg.Name, Time: junitTime(test.Elapsed)}
+			switch test.Status {
+			case "fail":
+				testCase.Failure = &junitMessage{Message: "Failed", Text: test.Output}
+			case "skip":
+				testCase.Skipped = &junitMessage{Message: "Skipped", Text: test.Output}
+			case "pass":
+				if test.Flaky {
+					testCase.Flaky = &junitMessage{Message: fmt.Sprintf("Passed after %d retries", test.Retries), Text: test.Output}
+				}
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	return WriteFileAtomic(file, 0644, func(w io.Writer) error {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(suites); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+}
+
+// junitTime formats a duration in seconds for a JUnit XML report.
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
@@ -0,0 +1,301 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTestRecorder(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		packages map[string]string
+		passed   int
+		failed   int
+		skipped  int
+		failures map[string]string
+	}{
+		{
+			name: "passing package",
+			output: `{"Action":"run","Package":"example.com/a","Test":"TestA"}
+{"Action":"output","Package":"example.com/a","Test":"TestA","Output":"=== RUN   TestA\n"}
+{"Action":"output","Package":"example.com/a","Test":"TestA","Output":"--- PASS: TestA (0.00s)\n"}
+{"Action":"pass","Package":"example.com/a","Test":"TestA","Elapsed":0.01}
+{"Action":"output","Package":"example.com/a","Output":"PASS\n"}
+{"Action":"pass","Package":"example.com/a","Elapsed":0.02}
+`,
+			packages: map[string]string{"example.com/a": "pass"},
+			passed:   1,
+		},
+		{
+			name: "failing and skipped tests",
+			output: `{"Action":"run","Package":"example.com/a","Test":"TestA"}
+{"Action":"output","Package":"example.com/a","Test":"TestA","Output":"=== RUN   TestA\n"}
+{"Action":"output","Package":"example.com/a","Test":"TestA","Output":"    a_test.go:10: wrong\n"}
+{"Action":"fail","Package":"example.com/a","Test":"TestA","Elapsed":0.01}
+{"Action":"run","Package":"example.com/a","Test":"TestB"}
+{"Action":"output","Package":"example.com/a","Test":"TestB","Output":"    b_test.go:5: later\n"}
+{"Action":"skip","Package":"example.com/a","Test":"TestB"}
+{"Action":"run","Package":"example.com/a","Test":"TestB/sub"}
+{"Action":"pass","Package":"example.com/a","Test":"TestB/sub"}
+{"Action":"fail","Package":"example.com/a","Elapsed":0.02}
+`,
+			packages: map[string]string{"example.com/a": "fail"},
+			passed:   1,
+			failed:   1,
+			skipped:  1,
+			failures: map[string]string{"TestA": "    a_test.go:10: wrong\n"},
+		},
+		{
+			name: "build failure",
+			output: `{"ImportPath":"example.com/b [example.com/b.test]","Action":"build-output","Output":"b.go:3:1: syntax error\n"}
+{"ImportPath":"example.com/b [example.com/b.test]","Action":"build-fail"}
+{"Action":"output","Package":"example.com/b","Output":"FAIL\texample.com/b [build failed]\n"}
+{"Action":"fail","Package":"example.com/b","Elapsed":0}
+`,
+			packages: map[string]string{"example.com/b": "fail"},
+		},
+		{
+			name: "interrupted test",
+			output: `{"Action":"run","Package":"example.com/c","Test":"TestC"}
+{"Action":"output","Package":"example.com/c","Test":"TestC","Output":"still running\n"}
+`,
+			packages: map[string]string{"example.com/c": "fail"},
+			failed:   1,
+			failures: map[string]string{"TestC": "still running\n"},
+		},
+		{
+			name:     "no test events",
+			output:   "go: downloading example.com/d v1.0.0\n\n",
+			packages: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		recorder := NewTestRecorder("test", false)
+		// split the output at arbitrary points like a pipe would
+		for output := test.output; output != ""; {
+			n := 7
+			if n > len(output) {
+				n = len(output)
+			}
+			if _, err := recorder.Write([]byte(output[:n])); err != nil {
+				t.Fatal(err)
+			}
+			output = output[n:]
+		}
+
+		report := recorder.Report()
+		if report.Passed != test.passed || report.Failed != test.failed || report.Skipped != test.skipped {
+			t.Errorf("%s: %d passed, %d failed, %d skipped, want %d, %d, %d", test.name,
+				report.Passed, report.Failed, report.Skipped, test.passed, test.failed, test.skipped)
+		}
+		if len(report.Packages) != len(test.packages) {
+			t.Errorf("%s: %d packages, want %d", test.name, len(report.Packages), len(test.packages))
+		}
+		for _, pkg := range report.Packages {
+			if status, ok := test.packages[pkg.Name]; !ok || pkg.Status != status {
+				t.Errorf("%s: package %s has status %q, want %q", test.name, pkg.Name, pkg.Status, status)
+			}
+			if pkg.Status == "pass" && pkg.Output != "" {
+				t.Errorf("%s: passing package %s kept its output", test.name, pkg.Name)
+			}
+			for _, result := range pkg.Tests {
+				if output, ok := test.failures[result.Name]; ok && result.Output != output {
+					t.Errorf("%s: output of %s = %q, want %q", test.name, result.Name, result.Output, output)
+				}
+				if result.Status == "pass" && result.Output != "" {
+					t.Errorf("%s: passing test %s kept its output", test.name, result.Name)
+				}
+			}
+		}
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	report := TestReport{
+		Passed: 1, Failed: 1, Skipped: 1, Elapsed: 1.5,
+		Packages: []PackageResult{
+			{Name: "example.com/a", Status: "fail", Elapsed: 1.5, Passed: 1, Failed: 1, Skipped: 1, Output: "FAIL\n", Tests: []TestResult{
+				{Name: "TestA", Status: "pass"},
+				{Name: "TestB", Status: "fail", Output: "wrong\n"},
+				{Name: "TestC", Status: "skip", Output: "later\n"},
+			}},
+			{Name: "example.com/b", Status: "fail", Output: "syntax error\n", Tests: []TestResult{}},
+		},
+	}
+	file := filepath.Join(t.TempDir(), "junit.xml")
+	if err := report.WriteJUnit(file); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) {
+		t.Errorf("JUnit report does not start with the XML header")
+	}
+
+	suites := junitTestSuites{}
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Skipped != 1 || suites.Errors != 1 || len(suites.Suites) != 2 {
+		t.Fatalf("JUnit report = %+v", suites)
+	}
+	if cases := suites.Suites[0].Cases; len(cases) != 3 || cases[0].Failure != nil || cases[1].Failure == nil || cases[1].Failure.Text != "wrong\n" || cases[2].Skipped == nil {
+		t.Errorf("test cases = %+v", cases)
+	}
+	if suite := suites.Suites[1]; suite.Errors != 1 || suite.SystemOut != "syntax error\n" {
+		t.Errorf("suite of the package that failed to build = %+v", suite)
+	}
+}
+
+func TestFailedTests(t *testing.T) {
+	tests := []struct {
+		tests  []TestResult
+		failed []string
+	}{
+		{[]TestResult{}, []string{}},
+		{[]TestResult{{Name: "TestA", Status: "pass"}, {Name: "TestB", Status: "skip"}}, []string{}},
+		{[]TestResult{{Name: "TestB", Status: "fail"}, {Name: "TestA", Status: "fail"}}, []string{"TestA", "TestB"}},
+		{[]TestResult{{Name: "TestA/sub", Status: "fail"}, {Name: "TestA", Status: "fail"}}, []string{"TestA"}},
+		{[]TestResult{{Name: "TestA/sub/deep", Status: "fail"}, {Name: "TestA/other", Status: "pass"}}, []string{"TestA"}},
+	}
+	for _, test := range tests {
+		result := PackageResult{Tests: test.tests}
+		if failed := result.FailedTests(); !reflect.DeepEqual(failed, test.failed) {
+			t.Errorf("FailedTests of %+v = %q, want %q", test.tests, failed, test.failed)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous PackageResult
+		retry    PackageResult
+		status   string
+		passed   int
+		failed   int
+		flaky    []string
+		output   map[string]string
+	}{
+		{
+			name: "flaky test",
+			previous: PackageResult{Status: "fail", Output: "FAIL\n", Tests: []TestResult{
+				{Name: "TestA", Status: "pass"},
+				{Name: "TestB", Status: "fail", Output: "timeout\n"},
+			}},
+			retry:  PackageResult{Status: "pass", Tests: []TestResult{{Name: "TestB", Status: "pass"}}},
+			status: "pass",
+			passed: 2,
+			flaky:  []string{"TestB"},
+			output: map[string]string{"TestB": "timeout\n"},
+		},
+		{
+			name: "failing again",
+			previous: PackageResult{Status: "fail", Tests: []TestResult{
+				{Name: "TestB", Status: "fail", Output: "first\n"},
+			}},
+			retry:  PackageResult{Status: "fail", Output: "FAIL again\n", Tests: []TestResult{{Name: "TestB", Status: "fail", Output: "second\n"}}},
+			status: "fail",
+			failed: 1,
+			flaky:  []string{},
+			output: map[string]string{"TestB": "second\n"},
+		},
+		{
+			name: "flaky subtest",
+			previous: PackageResult{Status: "fail", Tests: []TestResult{
+				{Name: "TestA", Status: "fail"},
+				{Name: "TestA/one", Status: "fail"},
+				{Name: "TestA/two", Status: "pass"},
+			}},
+			retry: PackageResult{Status: "pass", Tests: []TestResult{
+				{Name: "TestA", Status: "pass"},
+				{Name: "TestA/one", Status: "pass"},
+				{Name: "TestA/two", Status: "pass"},
+			}},
+			status: "pass",
+			passed: 3,
+			flaky:  []string{"TestA", "TestA/one"},
+		},
+		{
+			name:     "new test in the retry",
+			previous: PackageResult{Status: "fail", Tests: []TestResult{{Name: "TestA", Status: "fail"}}},
+			retry: PackageResult{Status: "pass", Tests: []TestResult{
+				{Name: "TestA", Status: "pass"},
+				{Name: "TestA/generated", Status: "pass"},
+			}},
+			status: "pass",
+			passed: 2,
+			flaky:  []string{"TestA"},
+		},
+		{
+			name:     "package fails without failing test",
+			previous: PackageResult{Status: "fail", Tests: []TestResult{{Name: "TestA", Status: "fail"}}},
+			retry:    PackageResult{Status: "fail", Output: "panic\n", Tests: []TestResult{{Name: "TestA", Status: "pass"}}},
+			status:   "fail",
+			passed:   1,
+			flaky:    []string{"TestA"},
+		},
+	}
+	for _, test := range tests {
+		result := test.previous
+		result.count()
+		result.Retry(test.retry, 1)
+
+		if result.Status != test.status || result.Passed != test.passed || result.Failed != test.failed || result.Flaky != len(test.flaky) {
+			t.Errorf("%s: status %s with %d passed, %d failed, %d flaky, want %s with %d, %d, %d", test.name,
+				result.Status, result.Passed, result.Failed, result.Flaky, test.status, test.passed, test.failed, len(test.flaky))
+		}
+		if result.Status == "pass" && result.Output != "" {
+			t.Errorf("%s: passing package kept the output %q", test.name, result.Output)
+		}
+		if result.Status == "fail" && result.Output != test.retry.Output {
+			t.Errorf("%s: output = %q, want the output of the retry %q", test.name, result.Output, test.retry.Output)
+		}
+		flaky := []string{}
+		for _, r := range result.Tests {
+			if r.Flaky {
+				flaky = append(flaky, r.Name)
+			}
+			if output, ok := test.output[r.Name]; ok && r.Output != output {
+				t.Errorf("%s: output of %s = %q, want %q", test.name, r.Name, r.Output, output)
+			}
+		}
+		if !reflect.DeepEqual(flaky, test.flaky) {
+			t.Errorf("%s: flaky tests %q, want %q", test.name, flaky, test.flaky)
+		}
+	}
+
+	// a test stays flaky when it passes again in a later retry
+	result := PackageResult{Status: "fail", Tests: []TestResult{{Name: "TestA", Status: "fail"}}}
+	result.Retry(PackageResult{Status: "pass", Tests: []TestResult{{Name: "TestA", Status: "pass"}}}, 1)
+	result.Retry(PackageResult{Status: "pass", Tests: []TestResult{{Name: "TestA", Status: "pass"}}}, 2)
+	if test := result.Tests[0]; !test.Flaky || test.Retries != 2 {
+		t.Errorf("TestA after two retries = %+v, want flaky with 2 retries", test)
+	}
+}
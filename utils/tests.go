@@ -0,0 +1,151 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The testValueFlags are the flags of 'go test' and of the go build system that take a separate
+// value, e.g. "-run TestX".
+var testValueFlags = map[string]bool{
+	"asmflags": true, "bench": true, "benchtime": true, "blockprofile": true, "blockprofilerate": true,
+	"count": true, "covermode": true, "coverpkg": true, "coverprofile": true, "cpu": true,
+	"cpuprofile": true, "exec": true, "fuzz": true, "fuzzminimizetime": true, "fuzztime": true,
+	"gccgoflags": true, "gcflags": true, "installsuffix": true, "ldflags": true, "list": true,
+	"memprofile": true, "memprofilerate": true, "mod": true, "modfile": true, "mutexprofile": true,
+	"mutexprofilefraction": true, "o": true, "outputdir": true, "overlay": true, "p": true,
+	"parallel": true, "pgo": true, "pkgdir": true, "run": true, "shuffle": true, "skip": true,
+	"tags": true, "timeout": true, "toolexec": true, "trace": true, "vet": true,
+}
+
+// SplitTestArgs splits the arguments of 'go test' into flags and package patterns. Everything after
+// -args is passed to the test binaries and therefore a flag.
+func SplitTestArgs(args []string) ([]string, []string) {
+	flags := []string{}
+	patterns := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-args" || arg == "--args":
+			return append(flags, args[i:]...), patterns
+		case strings.HasPrefix(arg, "-"):
+			flags = append(flags, arg)
+			name := strings.TrimLeft(arg, "-")
+			name = strings.TrimPrefix(name, "test.")
+			if !strings.Contains(name, "=") && testValueFlags[name] && i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+	return flags, patterns
+}
+
+// GetTestInputs returns the paths of the files every test binary of the given packages (patterns) is
+// built from by the import path of the package. This includes the files of every local package the
+// tests import directly or indirectly, so a change of a file only affects the tests of the packages
+// that depend on it. The files in the testdata directory of a package, e.g. golden files, are inputs
+// of its tests as well. Packages without test files are not part of the result.
+func GetTestInputs(patterns ...string) (map[string][]string, error) {
+	packages, err := ListPackages(nil, append([]string{"-deps", "-test"}, patterns...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := map[string]ListedPackage{}
+	for _, pkg := range packages {
+		byPath[pkg.ImportPath] = pkg
+	}
+
+	wd, _ := os.Getwd()
+	inputs := map[string][]string{}
+	for _, pkg := range packages {
+		// the generated main package of a test binary imports all packages of the test
+		if pkg.ForTest != "" || !strings.HasSuffix(pkg.ImportPath, ".test") || !pkg.IsLocal() {
+			continue
+		}
+		files := map[string]bool{}
+		for _, file := range GetModuleFiles() {
+			files[file] = true
+		}
+		add := func(paths []string) {
+			for _, file := range paths {
+				if rel, err := filepath.Rel(wd, file); err == nil {
+					file = rel
+				}
+				if !IsIgnored(file) {
+					files[file] = true
+				}
+			}
+		}
+		for _, dep := range pkg.Deps {
+			if listed, ok := byPath[dep]; ok && listed.IsLocal() {
+				add(listed.Files(true))
+			}
+		}
+		if tested, ok := byPath[strings.TrimSuffix(pkg.ImportPath, ".test")]; ok {
+			add(tested.TestdataFiles())
+		}
+
+		paths := make([]string, 0, len(files))
+		for file := range files {
+			paths = append(paths, file)
+		}
+		sort.Strings(paths)
+		inputs[strings.TrimSuffix(pkg.ImportPath, ".test")] = paths
+	}
+	return inputs, nil
+}
+
+// TestResultFile returns the path of the file the result of the tests of a package is stored in.
+// The file is the output of the cache target of the tests of the package.
+func TestResultFile(pkg string) string {
+	return filepath.Join(".burrow", "test", url.QueryEscape(pkg)+".json")
+}
+
+// ReadTestResult reads the stored result of the tests of a package.
+func ReadTestResult(pkg string) (PackageResult, error) {
+	result := PackageResult{}
+	data, err := ioutil.ReadFile(TestResultFile(pkg))
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+// WriteTestResult stores the result of the tests of a package.
+func WriteTestResult(result PackageResult) error {
+	return WriteFileAtomic(TestResultFile(result.Name), 0644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	})
+}
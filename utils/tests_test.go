@@ -0,0 +1,108 @@
+/* burrow - a go build system that uses glide for dependency management.
+ *
+ * Copyright (C) 2017  EmbeddedEnterprises
+ *     Fin Christensen <christensen.fin@gmail.com>,
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package burrow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitTestArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		flags    []string
+		patterns []string
+	}{
+		{[]string{}, []string{}, []string{}},
+		{[]string{"./..."}, []string{}, []string{"./..."}},
+		{[]string{"-run=x", "./lib"}, []string{"-run=x"}, []string{"./lib"}},
+		{[]string{"-run", "x", "./lib"}, []string{"-run", "x"}, []string{"./lib"}},
+		{[]string{"--run", "x", "./lib"}, []string{"--run", "x"}, []string{"./lib"}},
+		{[]string{"-test.run", "x", "./lib"}, []string{"-test.run", "x"}, []string{"./lib"}},
+		{[]string{"-v", "./lib", "./cmd/..."}, []string{"-v"}, []string{"./lib", "./cmd/..."}},
+		{[]string{"-count", "1", "-race", "."}, []string{"-count", "1", "-race"}, []string{"."}},
+		{[]string{"./lib", "-run"}, []string{"-run"}, []string{"./lib"}},
+		{[]string{".", "-args", "-update", "x"}, []string{"-args", "-update", "x"}, []string{"."}},
+	}
+	for _, test := range tests {
+		flags, patterns := SplitTestArgs(test.args)
+		if !reflect.DeepEqual(flags, test.flags) || !reflect.DeepEqual(patterns, test.patterns) {
+			t.Errorf("SplitTestArgs(%q) = %q, %q, want %q, %q", test.args, flags, patterns, test.flags, test.patterns)
+		}
+	}
+}
+
+func TestGetTestInputs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":              "module example.com/t\n\ngo 1.16\n",
+		"a/a.go":              "package a\n",
+		"a/a_test.go":         "package a\n",
+		"a/testdata/golden":   "golden\n",
+		"b/b.go":              "package b\n\nimport _ \"example.com/t/a\"\n",
+		"b/b_test.go":         "package b\n",
+		"c/c.go":              "package c\n",
+		"c/testdata/ignored":  "no tests\n",
+		"d/d_test.go":         "package d\n\nimport _ \"example.com/t/c\"\n",
+		"d/testdata/sub/file": "nested\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs, err := GetTestInputs("./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"example.com/t/a": {"a/a.go", "a/a_test.go", "a/testdata/golden", "go.mod"},
+		"example.com/t/b": {"a/a.go", "a/a_test.go", "b/b.go", "b/b_test.go", "go.mod"},
+		"example.com/t/d": {"c/c.go", "d/d_test.go", "d/testdata/sub/file", "go.mod"},
+	}
+	for pkg, paths := range expected {
+		for i := range paths {
+			paths[i] = filepath.FromSlash(paths[i])
+		}
+		if !reflect.DeepEqual(inputs[pkg], paths) {
+			t.Errorf("inputs of %s = %q, want %q", pkg, inputs[pkg], paths)
+		}
+	}
+	if len(inputs) != len(expected) {
+		t.Errorf("GetTestInputs returned %d packages, want %d", len(inputs), len(expected))
+	}
+}